@@ -13,6 +13,7 @@ func newACCmd(app *application) *cobra.Command {
 
 	cmd.AddCommand(
 		newACGetCmd(app),
+		newACPutCmd(app),
 	)
 
 	return &cmd
@@ -1,25 +1,117 @@
 package main
 
 import (
+	"context"
 	"errors"
 	"fmt"
+	"strings"
 
+	remoteexecution "github.com/bazelbuild/remote-apis/build/bazel/remote/execution/v2"
 	"github.com/spf13/cobra"
+
+	"github.com/leboncoin/bazel-remote-cache-client/pkg/bzlremotecache"
 )
 
 func newACGetCmd(app *application) *cobra.Command {
-	return app.newRemoteCacheCommand(&cobra.Command{
+	var (
+		digests       []*bzlremotecache.Digest
+		allowHashOnly bool
+		downloadDir   string
+		jobs          int
+		showTrees     bool
+		showStdout    bool
+		showStderr    bool
+		inlineOutputs bool
+		maxLines      int
+		tail          bool
+	)
+
+	cmd := cobra.Command{
 		Use:   "get [flags] <digest> ...",
 		Short: "Get action result metadata from Bazel remote cache",
 		Args:  cobra.MinimumNArgs(1),
+		PreRunE: func(cmd *cobra.Command, args []string) error {
+			digests = make([]*bzlremotecache.Digest, len(args))
+			for i, arg := range args {
+				var err error
+
+				digests[i], err = parseActionDigest(arg, allowHashOnly)
+				if err != nil {
+					return err
+				}
+			}
+
+			if jobs < 1 {
+				return errors.New("the number of jobs must be positive")
+			}
+
+			if maxLines < 0 {
+				return errors.New("the maximum number of lines can't be negative")
+			}
+
+			return nil
+		},
 		RunE: func(cmd *cobra.Command, args []string) error {
 			var (
 				hasError       bool
 				hasCacheResult bool
+				records        *recordWriter
 			)
 
-			for _, digest := range args {
-				result, err := app.BazelRemoteCache.GetCacheResult(cmd.Context(), digest)
+			if app.OutputFormat.IsStructured() {
+				records = newRecordWriter(app.OutputFormat)
+			}
+
+			for i, digest := range args {
+				result, err := app.BazelRemoteCache.GetCacheResult(
+					cmd.Context(), digests[i],
+					bzlremotecache.GetCacheResultOptions{
+						InlineStdout: inlineOutputs && showStdout,
+						InlineStderr: inlineOutputs && showStderr,
+					},
+				)
+
+				var (
+					content  actionResultContent
+					failures []downloadFailure
+				)
+
+				if err == nil {
+					if showTrees {
+						fetchOutputTrees(cmd.Context(), app, result, &content)
+					}
+
+					if showStdout {
+						content.stdout = fetchActionOutput(cmd.Context(), app, result.StdoutDigest, result.StdoutRaw)
+						content.stdout.maxLines, content.stdout.tail = maxLines, tail
+					}
+
+					if showStderr {
+						content.stderr = fetchActionOutput(cmd.Context(), app, result.StderrDigest, result.StderrRaw)
+						content.stderr.maxLines, content.stderr.tail = maxLines, tail
+					}
+
+					if downloadDir != "" {
+						failures = downloadActionResult(cmd.Context(), app, digests[i], result, downloadDir, jobs)
+					}
+				}
+
+				if err != nil || len(failures) > 0 {
+					hasError = true
+				}
+
+				if records != nil {
+					record, recErr := actionResultRecord(app, digest, result, err, &content, failures)
+					if recErr != nil {
+						return recErr
+					}
+
+					if recErr := records.Write(record); recErr != nil {
+						return recErr
+					}
+
+					continue
+				}
 
 				if hasCacheResult {
 					fmt.Println()
@@ -31,20 +123,180 @@ func newACGetCmd(app *application) *cobra.Command {
 						acDigestColor.Sprint(digest),
 						errorColor.Sprint(app.BazelRemoteCache.ErrorMsg(err)),
 					)
-					hasError = true
 				} else {
 					fmt.Printf("%s:\n", acDigestColor.Sprint(digest))
-					printActionResult("  ", result)
+					printActionResultWithContent("  ", result, &content)
+
+					if len(failures) > 0 {
+						printDownloadFailures("  ", app, failures)
+					}
 				}
 
 				hasCacheResult = true
 			}
 
+			if records != nil {
+				if err := records.Close(); err != nil {
+					return err
+				}
+			}
+
 			if hasError {
 				return errors.New("all action result hasn't been retrieved")
 			}
 
 			return nil
 		},
-	})
+	}
+
+	fl := cmd.Flags()
+	fl.BoolVarP(
+		&allowHashOnly, "allow-hash-only", "", false,
+		"Accept digests without size, sent with a placeholder size "+
+			"for remote caches ignoring it",
+	)
+	fl.BoolVarP(
+		&showTrees, "show-trees", "t", false,
+		"Show the content of the output directories",
+	)
+	fl.BoolVarP(
+		&showStdout, "show-stdout", "", false,
+		"Show the stdout of the actions",
+	)
+	fl.BoolVarP(
+		&showStderr, "show-stderr", "", false,
+		"Show the stderr of the actions",
+	)
+	fl.BoolVarP(
+		&inlineOutputs, "inline-outputs", "", false,
+		"Request the remote cache to inline the shown stdout and stderr in the action results",
+	)
+	fl.IntVarP(
+		&maxLines, "max-lines", "", 0,
+		"Maximum number of shown stdout and stderr lines (0 for no limit)",
+	)
+	fl.BoolVarP(
+		&tail, "tail", "", false,
+		"Show the last stdout and stderr lines instead of the first ones",
+	)
+	fl.StringVarP(
+		&downloadDir, "download", "d", "",
+		"Download the action outputs in the given directory, laid out like the execution root",
+	)
+	fl.IntVarP(
+		&jobs, "jobs", "j", 4,
+		"Number of concurrent downloads of large outputs",
+	)
+
+	return app.newRemoteCacheCommand(&cmd)
+}
+
+// parseActionDigest parses an action digest in the form hash/size,
+// or only its hash if allowed.
+func parseActionDigest(s string, allowHashOnly bool) (*bzlremotecache.Digest, error) {
+	if allowHashOnly && !strings.Contains(s, "/") {
+		// Size-less form historically sent by this tool, accepted by the
+		// remote caches only keyed on the hash like bazel-remote.
+		return &bzlremotecache.Digest{Hash: s, Size: 1}, nil
+	}
+
+	return bzlremotecache.ParseDigestFromString(s)
+}
+
+// fetchOutputTrees fetches the trees of the output directories
+// of an action result.
+func fetchOutputTrees(
+	ctx context.Context, app *application, ar *remoteexecution.ActionResult,
+	content *actionResultContent,
+) {
+	content.trees = make(map[string]*remoteexecution.Tree, len(ar.OutputDirectories))
+	content.treeErrors = make(map[string]error)
+
+	for _, od := range ar.OutputDirectories {
+		tree, err := app.BazelRemoteCache.GetTree(ctx, bzlremotecache.DigestFromProto(od.TreeDigest))
+		if err != nil {
+			content.treeErrors[od.Path] = errors.New(app.BazelRemoteCache.ErrorMsg(err))
+		} else {
+			content.trees[od.Path] = tree
+		}
+	}
+}
+
+// fetchActionOutput returns the stdout or the stderr of an action,
+// read from the CAS if it isn't inlined in the action result.
+func fetchActionOutput(
+	ctx context.Context, app *application, digest *remoteexecution.Digest, raw []byte,
+) *actionOutput {
+	if len(raw) > 0 || digest.GetSizeBytes() == 0 {
+		return &actionOutput{data: raw}
+	}
+
+	data, err := app.BazelRemoteCache.GetBlob(ctx, bzlremotecache.DigestFromProto(digest))
+	if err != nil {
+		return &actionOutput{err: errors.New(app.BazelRemoteCache.ErrorMsg(err))}
+	}
+
+	return &actionOutput{data: data}
+}
+
+// actionResultRecord returns the record of an action result
+// printed with a structured output.
+func actionResultRecord(
+	app *application, digest string, ar *remoteexecution.ActionResult, err error,
+	content *actionResultContent, failures []downloadFailure,
+) (map[string]interface{}, error) {
+	record := map[string]interface{}{
+		"digest": digest,
+	}
+
+	if err != nil {
+		record["error"] = app.BazelRemoteCache.ErrorMsg(err)
+		return record, nil
+	}
+
+	var recErr error
+	if record["action_result"], recErr = protoRecord(ar); recErr != nil {
+		return nil, recErr
+	}
+
+	if content.trees != nil {
+		trees := make(map[string]interface{}, len(content.trees))
+		for treePath, tree := range content.trees {
+			if trees[treePath], recErr = protoRecord(tree); recErr != nil {
+				return nil, recErr
+			}
+		}
+
+		for treePath, treeErr := range content.treeErrors {
+			trees[treePath] = map[string]interface{}{"error": treeErr.Error()}
+		}
+
+		record["output_trees"] = trees
+	}
+
+	for name, output := range map[string]*actionOutput{
+		"stdout": content.stdout,
+		"stderr": content.stderr,
+	} {
+		if output == nil {
+			continue
+		}
+
+		if output.err != nil {
+			record[name+"_error"] = output.err.Error()
+		} else {
+			record[name] = string(output.data)
+		}
+	}
+
+	if len(failures) > 0 {
+		downloadErrors := make(map[string]string, len(failures))
+		for _, failure := range failures {
+			downloadErrors[failure.path] = app.BazelRemoteCache.ErrorMsg(failure.err)
+		}
+
+		record["download_errors"] = downloadErrors
+	}
+
+	return record, nil
 }
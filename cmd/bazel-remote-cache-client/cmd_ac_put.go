@@ -0,0 +1,299 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	remoteexecution "github.com/bazelbuild/remote-apis/build/bazel/remote/execution/v2"
+	"github.com/spf13/cobra"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/encoding/prototext"
+
+	"github.com/leboncoin/bazel-remote-cache-client/pkg/bzlremotecache"
+)
+
+func newACPutCmd(app *application) *cobra.Command {
+	var (
+		digest         *bzlremotecache.Digest
+		fromFilePath   string
+		outputFiles    []string
+		outputDirs     []string
+		stdoutFilePath string
+		stderrFilePath string
+		exitCode       int32
+		dryRun         bool
+		jobs           int
+	)
+
+	cmd := cobra.Command{
+		Use:   "put [flags] <digest>",
+		Short: "Write an action result to the remote Bazel cache",
+		Args:  cobra.ExactArgs(1),
+		PreRunE: func(cmd *cobra.Command, args []string) error {
+			var err error
+			if digest, err = bzlremotecache.ParseDigestFromString(args[0]); err != nil {
+				return err
+			}
+
+			if jobs < 1 {
+				return errors.New("the number of jobs must be positive")
+			}
+
+			return nil
+		},
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ar := &remoteexecution.ActionResult{}
+			if fromFilePath != "" {
+				var err error
+				if ar, err = readActionResultFile(fromFilePath); err != nil {
+					return err
+				}
+			}
+
+			// The blobs referenced by the description are expected in the cache.
+			referenced := actionResultDigests(ar)
+
+			var blobs []*bzlremotecache.Blob
+			for _, outputFile := range outputFiles {
+				localPath, outputPath, err := parseLocalOutput(outputFile)
+				if err != nil {
+					return err
+				}
+
+				fi, err := os.Stat(localPath)
+				if err != nil {
+					return err
+				}
+
+				blob, err := bzlremotecache.NewFileBlob(localPath)
+				if err != nil {
+					return err
+				}
+
+				blobs = append(blobs, blob)
+				ar.OutputFiles = append(ar.OutputFiles, &remoteexecution.OutputFile{
+					Path:         outputPath,
+					Digest:       blob.Digest.ToProto(),
+					IsExecutable: fi.Mode()&0111 != 0,
+				})
+			}
+
+			for _, outputDir := range outputDirs {
+				localPath, outputPath, err := parseLocalOutput(outputDir)
+				if err != nil {
+					return err
+				}
+
+				ld, err := bzlremotecache.ReadLocalDirectory(localPath)
+				if err != nil {
+					return fmt.Errorf("can't read the directory %s: %v", localPath, err)
+				}
+
+				blobs = append(blobs, ld.Blobs...)
+				ar.OutputDirectories = append(ar.OutputDirectories, &remoteexecution.OutputDirectory{
+					Path:       outputPath,
+					TreeDigest: ld.TreeDigest.ToProto(),
+				})
+			}
+
+			for _, output := range []struct {
+				path   string
+				digest **remoteexecution.Digest
+			}{
+				{stdoutFilePath, &ar.StdoutDigest},
+				{stderrFilePath, &ar.StderrDigest},
+			} {
+				if output.path == "" {
+					continue
+				}
+
+				blob, err := bzlremotecache.NewFileBlob(output.path)
+				if err != nil {
+					return err
+				}
+
+				blobs = append(blobs, blob)
+				*output.digest = blob.Digest.ToProto()
+			}
+
+			if cmd.Flags().Changed("exit-code") {
+				ar.ExitCode = exitCode
+			}
+
+			if !dryRun {
+				if _, err := app.BazelRemoteCache.UploadBlobs(cmd.Context(), blobs, jobs); err != nil {
+					return err
+				}
+
+				if len(referenced) > 0 {
+					missing, err := app.BazelRemoteCache.FindMissingBlobs(cmd.Context(), referenced)
+					if err != nil {
+						return fmt.Errorf("can't find the missing blobs: %v", err)
+					}
+
+					for _, d := range missing {
+						_, _ = fmt.Fprintf(os.Stderr, "Warning: Blob %s referenced by the action result isn't in the cache\n", d)
+					}
+				}
+
+				var err error
+				if ar, err = app.BazelRemoteCache.UpdateActionResult(cmd.Context(), digest, ar); err != nil {
+					return fmt.Errorf("can't write the action result: %s", app.BazelRemoteCache.ErrorMsg(err))
+				}
+			}
+
+			if app.OutputFormat.IsStructured() {
+				records := newRecordWriter(app.OutputFormat)
+
+				record, err := actionResultRecord(app, digest.String(), ar, nil, &actionResultContent{}, nil)
+				if err != nil {
+					return err
+				}
+
+				record["dry_run"] = dryRun
+
+				if err := records.Write(record); err != nil {
+					return err
+				}
+
+				return records.Close()
+			}
+
+			if dryRun {
+				fmt.Printf("%s: %s\n", acDigestColor.Sprint(digest), faintColor.Sprint("(dry run)"))
+			} else {
+				fmt.Printf("%s:\n", acDigestColor.Sprint(digest))
+			}
+
+			printActionResult("  ", ar)
+
+			return nil
+		},
+		Example: `  To write an action result with an output file and its stdout:
+	$ bazel-remote-cache-client ac put --remote localhost:9092 \
+	    --output-file bazel-bin/app.tar=bazel-out/k8-fastbuild/bin/app.tar \
+	    --stdout-file /tmp/stdout.txt \
+	    908085c97f53e58132f07eb7c64118ec05a67ed7ab93102b914e54b96c293488/142
+
+  To check an action result described in JSON without writing it:
+	$ bazel-remote-cache-client ac put --remote localhost:9092 --dry-run \
+	    --from-file action_result.json \
+	    908085c97f53e58132f07eb7c64118ec05a67ed7ab93102b914e54b96c293488/142`,
+	}
+
+	fl := cmd.Flags()
+	fl.StringVarP(
+		&fromFilePath, "from-file", "f", "",
+		"ActionResult described in JSON, in text format or by the json output of ac get, - for the standard input",
+	)
+	fl.StringArrayVarP(
+		&outputFiles, "output-file", "", nil,
+		"Local file uploaded as an output file (<path>[=<output path>]), can be repeated",
+	)
+	fl.StringArrayVarP(
+		&outputDirs, "output-dir", "", nil,
+		"Local directory uploaded as an output directory (<path>[=<output path>]), can be repeated",
+	)
+	fl.StringVarP(
+		&stdoutFilePath, "stdout-file", "", "",
+		"Local file uploaded as the stdout of the action",
+	)
+	fl.StringVarP(
+		&stderrFilePath, "stderr-file", "", "",
+		"Local file uploaded as the stderr of the action",
+	)
+	fl.Int32VarP(
+		&exitCode, "exit-code", "", 0,
+		"Exit code of the action",
+	)
+	fl.BoolVarP(
+		&dryRun, "dry-run", "n", false,
+		"Print the action result without uploading anything",
+	)
+	fl.IntVarP(
+		&jobs, "jobs", "j", 4,
+		"Number of concurrent uploads of large outputs",
+	)
+
+	return app.newRemoteCacheCommand(&cmd)
+}
+
+// readActionResultFile reads an ActionResult described in JSON, as written by
+// ac get with the json or jsonl output, or in text format if the content
+// doesn't start with a JSON object or list.
+func readActionResultFile(filePath string) (*remoteexecution.ActionResult, error) {
+	var (
+		data []byte
+		err  error
+	)
+
+	if filePath == "-" {
+		data, err = io.ReadAll(os.Stdin)
+	} else {
+		data, err = os.ReadFile(filePath)
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("can't read the action result: %v", err)
+	}
+
+	var ar remoteexecution.ActionResult
+	if trimmed := bytes.TrimSpace(data); bytes.HasPrefix(trimmed, []byte("{")) || bytes.HasPrefix(trimmed, []byte("[")) {
+		if data, err = actionResultJSON(data); err == nil {
+			err = protojson.Unmarshal(data, &ar)
+		}
+	} else {
+		err = prototext.Unmarshal(data, &ar)
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("can't decode the action result %s: %v", filePath, err)
+	}
+
+	return &ar, nil
+}
+
+// parseLocalOutput parses a local output in the form <path>[=<output path>],
+// the output path defaulting to the local path, which must be relative.
+func parseLocalOutput(s string) (string, string, error) {
+	localPath, outputPath, found := strings.Cut(s, "=")
+	if !found {
+		outputPath = localPath
+	}
+
+	outputPath = filepath.ToSlash(filepath.Clean(outputPath))
+	if filepath.IsAbs(outputPath) || outputPath == "." || outputPath == ".." || strings.HasPrefix(outputPath, "../") {
+		return "", "", fmt.Errorf(
+			"invalid output path %q, expected a path relative to the working directory, e.g. %s=<output path>",
+			outputPath, localPath,
+		)
+	}
+
+	return localPath, outputPath, nil
+}
+
+// actionResultDigests returns the digests of the blobs referenced
+// by an action result.
+func actionResultDigests(ar *remoteexecution.ActionResult) []*bzlremotecache.Digest {
+	var digests []*bzlremotecache.Digest
+	for _, of := range ar.OutputFiles {
+		digests = append(digests, bzlremotecache.DigestFromProto(of.Digest))
+	}
+
+	for _, od := range ar.OutputDirectories {
+		digests = append(digests, bzlremotecache.DigestFromProto(od.TreeDigest))
+	}
+
+	for _, d := range []*remoteexecution.Digest{ar.StdoutDigest, ar.StderrDigest} {
+		if d != nil {
+			digests = append(digests, bzlremotecache.DigestFromProto(d))
+		}
+	}
+
+	return digests
+}
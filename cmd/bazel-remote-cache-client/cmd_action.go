@@ -0,0 +1,19 @@
+package main
+
+import (
+	"github.com/spf13/cobra"
+)
+
+func newActionCmd(app *application) *cobra.Command {
+	cmd := cobra.Command{
+		Use:   "action [flags]",
+		Short: "Inspect actions stored in the CAS",
+	}
+
+	cmd.AddCommand(
+		newActionShowCmd(app),
+		newActionDiffCmd(app),
+	)
+
+	return &cmd
+}
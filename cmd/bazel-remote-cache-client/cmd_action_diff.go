@@ -0,0 +1,437 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	remoteexecution "github.com/bazelbuild/remote-apis/build/bazel/remote/execution/v2"
+	"github.com/spf13/cobra"
+	"google.golang.org/protobuf/proto"
+
+	"github.com/leboncoin/bazel-remote-cache-client/pkg/bzlremotecache"
+)
+
+func newActionDiffCmd(app *application) *cobra.Command {
+	var (
+		digestA *bzlremotecache.Digest
+		digestB *bzlremotecache.Digest
+	)
+
+	cmd := cobra.Command{
+		Use:   "diff [flags] <digest-a> <digest-b>",
+		Short: "Show why two actions have different digests",
+		Args:  cobra.ExactArgs(2),
+		PreRunE: func(cmd *cobra.Command, args []string) error {
+			var err error
+
+			if digestA, err = bzlremotecache.ParseDigestFromString(args[0]); err != nil {
+				return err
+			}
+
+			if digestB, err = bzlremotecache.ParseDigestFromString(args[1]); err != nil {
+				return err
+			}
+
+			return nil
+		},
+		RunE: func(cmd *cobra.Command, args []string) error {
+			diff, err := diffActions(cmd.Context(), app, digestA, digestB)
+			if err != nil {
+				return err
+			}
+
+			if app.OutputFormat.IsStructured() {
+				records := newRecordWriter(app.OutputFormat)
+				if err := records.Write(diff.record()); err != nil {
+					return err
+				}
+
+				return records.Close()
+			}
+
+			printActionDiff(diff)
+
+			return nil
+		},
+		Example: `  To find why an action missed the cache, compare its digest with the one
+  of a previous execution, e.g. found in gRPC logs or with the execution log:
+	$ bazel-remote-cache-client action diff --remote localhost:9092 \
+	    908085c97f53e58132f07eb7c64118ec05a67ed7ab93102b914e54b96c293488/142 \
+	    ed54247875d2f69fada38439d47bff3f322b2c8ce057a09d185699868ab30390/139`,
+	}
+
+	return app.newRemoteCacheCommand(&cmd)
+}
+
+// actionDiff contains the differences between two actions.
+type actionDiff struct {
+	digestA, digestB *bzlremotecache.Digest
+
+	// fields are the differences of the scalar fields of the actions
+	// and their commands.
+	fields []keyChange
+
+	arguments       []lineChange
+	environment     []keyChange
+	actionPlatform  []keyChange
+	commandPlatform []keyChange
+	outputPaths     []lineChange
+	inputs          []bzlremotecache.DirectoryChange
+}
+
+// IsEmpty reports whether no difference has been found.
+func (d *actionDiff) IsEmpty() bool {
+	return len(d.fields) == 0 && len(d.arguments) == 0 && len(d.environment) == 0 &&
+		len(d.actionPlatform) == 0 && len(d.commandPlatform) == 0 &&
+		len(d.outputPaths) == 0 && len(d.inputs) == 0
+}
+
+// keyChange is a value which differs between two maps,
+// a missing value being nil.
+type keyChange struct {
+	key      string
+	old, new *string
+}
+
+// lineChange is a line added (+), removed (-) or kept ( ) in a list.
+type lineChange struct {
+	op   byte
+	line string
+}
+
+func diffActions(
+	ctx context.Context, app *application, digestA, digestB *bzlremotecache.Digest,
+) (*actionDiff, error) {
+	actionA, err := app.BazelRemoteCache.GetAction(ctx, digestA)
+	if err != nil {
+		return nil, fmt.Errorf("can't get action %s: %s", digestA, app.BazelRemoteCache.ErrorMsg(err))
+	}
+
+	actionB, err := app.BazelRemoteCache.GetAction(ctx, digestB)
+	if err != nil {
+		return nil, fmt.Errorf("can't get action %s: %s", digestB, app.BazelRemoteCache.ErrorMsg(err))
+	}
+
+	diff := actionDiff{
+		digestA: digestA,
+		digestB: digestB,
+	}
+
+	diff.fields = diffMaps(
+		map[string]string{
+			"Timeout":    actionA.Timeout.AsDuration().String(),
+			"DoNotCache": fmt.Sprint(actionA.DoNotCache),
+			"Salt":       fmt.Sprintf("%x", actionA.Salt),
+		},
+		map[string]string{
+			"Timeout":    actionB.Timeout.AsDuration().String(),
+			"DoNotCache": fmt.Sprint(actionB.DoNotCache),
+			"Salt":       fmt.Sprintf("%x", actionB.Salt),
+		},
+	)
+	diff.actionPlatform = diffMaps(platformMap(actionA.Platform), platformMap(actionB.Platform))
+
+	if !proto.Equal(actionA.CommandDigest, actionB.CommandDigest) {
+		if err := diff.diffCommands(ctx, app, actionA, actionB); err != nil {
+			return nil, err
+		}
+	}
+
+	if !proto.Equal(actionA.InputRootDigest, actionB.InputRootDigest) {
+		rootDigestA := bzlremotecache.DigestFromProto(actionA.InputRootDigest)
+		rootDigestB := bzlremotecache.DigestFromProto(actionB.InputRootDigest)
+
+		// The directories shared by both input roots are only fetched once.
+		getDir, err := app.BazelRemoteCache.GetDirectories(ctx, rootDigestA, rootDigestB)
+		if err != nil {
+			return nil, fmt.Errorf("can't get the input roots: %s", app.BazelRemoteCache.ErrorMsg(err))
+		}
+
+		inputRootA, err := getDir(ctx, rootDigestA)
+		if err != nil {
+			return nil, fmt.Errorf("can't get the input root of %s: %s", digestA, app.BazelRemoteCache.ErrorMsg(err))
+		}
+
+		inputRootB, err := getDir(ctx, rootDigestB)
+		if err != nil {
+			return nil, fmt.Errorf("can't get the input root of %s: %s", digestB, app.BazelRemoteCache.ErrorMsg(err))
+		}
+
+		diff.inputs, err = bzlremotecache.DiffDirectories(ctx, inputRootA, inputRootB, getDir)
+		if err != nil {
+			return nil, fmt.Errorf("can't compare the input roots: %s", app.BazelRemoteCache.ErrorMsg(err))
+		}
+	}
+
+	return &diff, nil
+}
+
+func (d *actionDiff) diffCommands(ctx context.Context, app *application, actionA, actionB *remoteexecution.Action) error {
+	commandA, err := app.BazelRemoteCache.GetCommand(ctx, bzlremotecache.DigestFromProto(actionA.CommandDigest))
+	if err != nil {
+		return fmt.Errorf("can't get the command of %s: %s", d.digestA, app.BazelRemoteCache.ErrorMsg(err))
+	}
+
+	commandB, err := app.BazelRemoteCache.GetCommand(ctx, bzlremotecache.DigestFromProto(actionB.CommandDigest))
+	if err != nil {
+		return fmt.Errorf("can't get the command of %s: %s", d.digestB, app.BazelRemoteCache.ErrorMsg(err))
+	}
+
+	d.fields = append(d.fields, diffMaps(
+		map[string]string{"WorkingDirectory": commandA.WorkingDirectory},
+		map[string]string{"WorkingDirectory": commandB.WorkingDirectory},
+	)...)
+
+	if args := diffLines(commandA.Arguments, commandB.Arguments); hasLineChanges(args) {
+		d.arguments = args
+	}
+
+	d.environment = diffMaps(environmentMap(commandA), environmentMap(commandB))
+	d.commandPlatform = diffMaps(platformMap(commandA.Platform), platformMap(commandB.Platform))
+
+	outputPathsA := append(append(append([]string(nil), commandA.OutputPaths...), commandA.OutputFiles...), commandA.OutputDirectories...)
+	outputPathsB := append(append(append([]string(nil), commandB.OutputPaths...), commandB.OutputFiles...), commandB.OutputDirectories...)
+	if outputPaths := diffLines(outputPathsA, outputPathsB); hasLineChanges(outputPaths) {
+		d.outputPaths = outputPaths
+	}
+
+	return nil
+}
+
+func platformMap(platform *remoteexecution.Platform) map[string]string {
+	m := make(map[string]string, len(platform.GetProperties()))
+	for _, property := range platform.GetProperties() {
+		m[property.Name] = property.Value
+	}
+
+	return m
+}
+
+func environmentMap(command *remoteexecution.Command) map[string]string {
+	m := make(map[string]string, len(command.EnvironmentVariables))
+	for _, env := range command.EnvironmentVariables {
+		m[env.Name] = env.Value
+	}
+
+	return m
+}
+
+// diffMaps returns the values which differ between two maps, sorted by key.
+func diffMaps(a, b map[string]string) []keyChange {
+	var changes []keyChange
+
+	for key, valueA := range a {
+		valueA := valueA
+
+		valueB, ok := b[key]
+		if !ok {
+			changes = append(changes, keyChange{key: key, old: &valueA})
+		} else if valueA != valueB {
+			changes = append(changes, keyChange{key: key, old: &valueA, new: &valueB})
+		}
+	}
+
+	for key, valueB := range b {
+		valueB := valueB
+
+		if _, ok := a[key]; !ok {
+			changes = append(changes, keyChange{key: key, new: &valueB})
+		}
+	}
+
+	sort.Slice(changes, func(i, j int) bool {
+		return changes[i].key < changes[j].key
+	})
+
+	return changes
+}
+
+// maxDiffTableSize is the maximum number of cells of the table of the
+// longest common subsequence computed by diffLines.
+const maxDiffTableSize = 4 << 20
+
+// diffLines returns the edit script between two lists of lines
+// based on their longest common subsequence. The common prefix and suffix
+// are skipped, and the changed lines are listed as removed then added when
+// they are too many to compute their longest common subsequence.
+func diffLines(a, b []string) []lineChange {
+	var prefix, suffix int
+	for prefix < len(a) && prefix < len(b) && a[prefix] == b[prefix] {
+		prefix++
+	}
+
+	for suffix < len(a)-prefix && suffix < len(b)-prefix && a[len(a)-1-suffix] == b[len(b)-1-suffix] {
+		suffix++
+	}
+
+	changes := make([]lineChange, 0, len(a)+len(b)-prefix-suffix)
+	for _, line := range a[:prefix] {
+		changes = append(changes, lineChange{op: ' ', line: line})
+	}
+
+	midA, midB := a[prefix:len(a)-suffix], b[prefix:len(b)-suffix]
+	if (len(midA)+1)*(len(midB)+1) > maxDiffTableSize {
+		for _, line := range midA {
+			changes = append(changes, lineChange{op: '-', line: line})
+		}
+
+		for _, line := range midB {
+			changes = append(changes, lineChange{op: '+', line: line})
+		}
+	} else {
+		changes = append(changes, diffLinesLCS(midA, midB)...)
+	}
+
+	for _, line := range a[len(a)-suffix:] {
+		changes = append(changes, lineChange{op: ' ', line: line})
+	}
+
+	return changes
+}
+
+// diffLinesLCS returns the edit script between two lists of lines
+// with a table of their longest common subsequence.
+func diffLinesLCS(a, b []string) []lineChange {
+	lcs := make([][]int32, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int32, len(b)+1)
+	}
+
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			switch {
+			case a[i] == b[j]:
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			case lcs[i+1][j] >= lcs[i][j+1]:
+				lcs[i][j] = lcs[i+1][j]
+			default:
+				lcs[i][j] = lcs[i][j+1]
+			}
+		}
+	}
+
+	var (
+		changes []lineChange
+		i, j    int
+	)
+
+	for i < len(a) && j < len(b) {
+		switch {
+		case a[i] == b[j]:
+			changes = append(changes, lineChange{op: ' ', line: a[i]})
+			i++
+			j++
+		case lcs[i+1][j] >= lcs[i][j+1]:
+			changes = append(changes, lineChange{op: '-', line: a[i]})
+			i++
+		default:
+			changes = append(changes, lineChange{op: '+', line: b[j]})
+			j++
+		}
+	}
+
+	for ; i < len(a); i++ {
+		changes = append(changes, lineChange{op: '-', line: a[i]})
+	}
+
+	for ; j < len(b); j++ {
+		changes = append(changes, lineChange{op: '+', line: b[j]})
+	}
+
+	return changes
+}
+
+func hasLineChanges(changes []lineChange) bool {
+	for _, change := range changes {
+		if change.op != ' ' {
+			return true
+		}
+	}
+
+	return false
+}
+
+// record returns the record of the differences printed with a structured output.
+func (d *actionDiff) record() map[string]interface{} {
+	keyRecords := func(changes []keyChange) []interface{} {
+		records := make([]interface{}, len(changes))
+		for i, change := range changes {
+			record := map[string]interface{}{"name": change.key}
+			if change.old != nil {
+				record["old"] = *change.old
+			}
+			if change.new != nil {
+				record["new"] = *change.new
+			}
+			records[i] = record
+		}
+
+		return records
+	}
+
+	lineRecords := func(changes []lineChange) []interface{} {
+		records := []interface{}{}
+		for _, change := range changes {
+			if change.op != ' ' {
+				records = append(records, map[string]interface{}{
+					"op":    string(change.op),
+					"value": change.line,
+				})
+			}
+		}
+
+		return records
+	}
+
+	inputs := make([]interface{}, len(d.inputs))
+	for i, change := range d.inputs {
+		record := map[string]interface{}{"path": change.Path}
+		if change.Old != nil {
+			record["old"] = nodeRecord(change.Old)
+		}
+		if change.New != nil {
+			record["new"] = nodeRecord(change.New)
+		}
+		inputs[i] = record
+	}
+
+	return map[string]interface{}{
+		"digest_a":              d.digestA.String(),
+		"digest_b":              d.digestB.String(),
+		"fields":                keyRecords(d.fields),
+		"arguments":             lineRecords(d.arguments),
+		"environment_variables": keyRecords(d.environment),
+		"action_platform":       keyRecords(d.actionPlatform),
+		"command_platform":      keyRecords(d.commandPlatform),
+		"output_paths":          lineRecords(d.outputPaths),
+		"inputs":                inputs,
+	}
+}
+
+// nodeRecord returns the record of a directory node.
+func nodeRecord(node proto.Message) map[string]interface{} {
+	switch n := node.(type) {
+	case *remoteexecution.FileNode:
+		record := map[string]interface{}{
+			"type":   "file",
+			"digest": bzlremotecache.DigestFromProto(n.Digest).String(),
+		}
+		if n.IsExecutable {
+			record["is_executable"] = true
+		}
+		return record
+	case *remoteexecution.SymlinkNode:
+		return map[string]interface{}{
+			"type":   "symlink",
+			"target": n.Target,
+		}
+	case *remoteexecution.DirectoryNode:
+		return map[string]interface{}{
+			"type":   "directory",
+			"digest": bzlremotecache.DigestFromProto(n.Digest).String(),
+		}
+	default:
+		return nil
+	}
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+func TestDiffLines(t *testing.T) {
+	changes := diffLines(
+		[]string{"gcc", "-c", "-O2", "a.c", "-o", "a.o"},
+		[]string{"gcc", "-c", "-O0", "-g", "a.c", "-o", "a.o"},
+	)
+
+	expected := []lineChange{
+		{op: ' ', line: "gcc"},
+		{op: ' ', line: "-c"},
+		{op: '-', line: "-O2"},
+		{op: '+', line: "-O0"},
+		{op: '+', line: "-g"},
+		{op: ' ', line: "a.c"},
+		{op: ' ', line: "-o"},
+		{op: ' ', line: "a.o"},
+	}
+
+	if !reflect.DeepEqual(changes, expected) {
+		t.Errorf("expected %v, got %v", expected, changes)
+	}
+}
+
+func TestDiffLinesLarge(t *testing.T) {
+	a := make([]string, 50000)
+	b := make([]string, 50000)
+	for i := range a {
+		a[i] = fmt.Sprintf("a%d", i)
+		b[i] = fmt.Sprintf("b%d", i)
+	}
+
+	a[0], b[0] = "cmd", "cmd"
+
+	changes := diffLines(a, b)
+	if len(changes) != 1+2*(len(a)-1) {
+		t.Fatalf("expected %d changes, got %d", 1+2*(len(a)-1), len(changes))
+	}
+
+	if changes[0] != (lineChange{op: ' ', line: "cmd"}) ||
+		changes[1] != (lineChange{op: '-', line: "a1"}) ||
+		changes[len(a)] != (lineChange{op: '+', line: "b1"}) {
+		t.Errorf("unexpected changes %v ...", changes[:3])
+	}
+}
+
+func TestPrintLineChanges(t *testing.T) {
+	disableColor()
+
+	a := make([]string, 20)
+	for i := range a {
+		a[i] = fmt.Sprintf("-f%d", i)
+	}
+
+	b := append([]string{}, a...)
+	b[10] = "-g"
+
+	output := captureStdout(t, func() {
+		printLineChanges("Arguments", diffLines(a, b))
+	})
+
+	expected := `Arguments:
+    ... 7 unchanged ...
+    -f7
+    -f8
+    -f9
+  - -f10
+  + -g
+    -f11
+    -f12
+    -f13
+    ... 6 unchanged ...
+`
+	if output != expected {
+		t.Errorf("expected:\n%s\ngot:\n%s", expected, output)
+	}
+}
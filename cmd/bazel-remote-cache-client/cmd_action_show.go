@@ -0,0 +1,215 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	remoteexecution "github.com/bazelbuild/remote-apis/build/bazel/remote/execution/v2"
+	"github.com/spf13/cobra"
+	"google.golang.org/protobuf/proto"
+
+	"github.com/leboncoin/bazel-remote-cache-client/pkg/bzlremotecache"
+)
+
+func newActionShowCmd(app *application) *cobra.Command {
+	var (
+		digests []*bzlremotecache.Digest
+	)
+
+	cmd := cobra.Command{
+		Use:   "show [flags] <digest> ...",
+		Short: "Show the command and the inputs of actions",
+		Args:  cobra.MinimumNArgs(1),
+		PreRunE: func(cmd *cobra.Command, args []string) error {
+			digests = make([]*bzlremotecache.Digest, len(args))
+			for i, arg := range args {
+				var err error
+
+				digests[i], err = bzlremotecache.ParseDigestFromString(arg)
+				if err != nil {
+					return err
+				}
+			}
+
+			return nil
+		},
+		RunE: func(cmd *cobra.Command, args []string) error {
+			var (
+				hasError bool
+				records  *recordWriter
+			)
+
+			if app.OutputFormat.IsStructured() {
+				records = newRecordWriter(app.OutputFormat)
+			}
+
+			for i, digest := range digests {
+				if i > 0 && records == nil {
+					fmt.Println()
+				}
+
+				var ok bool
+				if records != nil {
+					var err error
+					if ok, err = writeActionRecord(cmd.Context(), app, records, digest); err != nil {
+						return err
+					}
+				} else {
+					ok = printActionDetails(cmd.Context(), app, digest)
+				}
+
+				if !ok {
+					hasError = true
+				}
+			}
+
+			if records != nil {
+				if err := records.Close(); err != nil {
+					return err
+				}
+			}
+
+			if hasError {
+				return errors.New("all actions haven't been retrieved")
+			}
+
+			return nil
+		},
+	}
+
+	return app.newRemoteCacheCommand(&cmd)
+}
+
+// printActionDetails prints an action with its command and its input root.
+// It returns whether the action has been fully retrieved.
+func printActionDetails(ctx context.Context, app *application, digest *bzlremotecache.Digest) bool {
+	action, err := app.BazelRemoteCache.GetAction(ctx, digest)
+	if err != nil {
+		fmt.Printf(
+			"%s: %s\n",
+			acDigestColor.Sprint(digest),
+			errorColor.Sprint(app.BazelRemoteCache.ErrorMsg(err)),
+		)
+		return false
+	}
+
+	fmt.Printf("%s:\n", acDigestColor.Sprint(digest))
+	fmt.Printf("  %s:\n", cf("Action"))
+	printAction("    ", action)
+
+	fmt.Printf("  %s:\n", cf("Command"))
+	command, err := app.BazelRemoteCache.GetCommand(ctx, bzlremotecache.DigestFromProto(action.CommandDigest))
+	if err != nil {
+		fmt.Printf("    |- %s\n", errorColor.Sprint(app.BazelRemoteCache.ErrorMsg(err)))
+		return false
+	}
+	printCommand("    ", command)
+
+	fmt.Printf("  %s:\n", cf("InputRoot"))
+	inputRoot, getDir, err := getInputRoot(ctx, app, action)
+	if err != nil {
+		fmt.Printf("    |- %s\n", errorColor.Sprint(app.BazelRemoteCache.ErrorMsg(err)))
+		return false
+	}
+	return printDirectory(ctx, "    ", inputRoot, getDir)
+}
+
+// getInputRoot returns the input root of an action, and a DirectoryGetter
+// of its subdirectories, which are all fetched beforehand.
+func getInputRoot(
+	ctx context.Context, app *application, action *remoteexecution.Action,
+) (*remoteexecution.Directory, bzlremotecache.DirectoryGetter, error) {
+	digest := bzlremotecache.DigestFromProto(action.InputRootDigest)
+
+	getDir, err := app.BazelRemoteCache.GetDirectories(ctx, digest)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	inputRoot, err := getDir(ctx, digest)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return inputRoot, getDir, nil
+}
+
+// writeActionRecord writes the record of an action with its command and
+// the nodes of its input root. It returns whether the action has been fully
+// retrieved.
+func writeActionRecord(
+	ctx context.Context, app *application, records *recordWriter, digest *bzlremotecache.Digest,
+) (bool, error) {
+	record := map[string]interface{}{
+		"digest": digest.String(),
+	}
+
+	ok := true
+	if err := fillActionRecord(ctx, app, record, digest); err != nil {
+		record["error"] = app.BazelRemoteCache.ErrorMsg(err)
+		ok = false
+	}
+
+	return ok, records.Write(record)
+}
+
+func fillActionRecord(
+	ctx context.Context, app *application, record map[string]interface{}, digest *bzlremotecache.Digest,
+) error {
+	action, err := app.BazelRemoteCache.GetAction(ctx, digest)
+	if err != nil {
+		return err
+	}
+
+	if record["action"], err = protoRecord(action); err != nil {
+		return err
+	}
+
+	command, err := app.BazelRemoteCache.GetCommand(ctx, bzlremotecache.DigestFromProto(action.CommandDigest))
+	if err != nil {
+		return err
+	}
+
+	if record["command"], err = protoRecord(command); err != nil {
+		return err
+	}
+
+	inputRoot, getDir, err := getInputRoot(ctx, app, action)
+	if err != nil {
+		return err
+	}
+
+	var inputs []interface{}
+	err = bzlremotecache.WalkDirectory(
+		ctx, inputRoot, getDir,
+		func(nodePath string, node proto.Message) error {
+			input := map[string]interface{}{
+				"path": nodePath,
+			}
+
+			switch n := node.(type) {
+			case *remoteexecution.FileNode:
+				input["type"] = "file"
+				input["digest"] = bzlremotecache.DigestFromProto(n.Digest).String()
+				if n.IsExecutable {
+					input["is_executable"] = true
+				}
+			case *remoteexecution.SymlinkNode:
+				input["type"] = "symlink"
+				input["target"] = n.Target
+			case *remoteexecution.DirectoryNode:
+				input["type"] = "directory"
+				input["digest"] = bzlremotecache.DigestFromProto(n.Digest).String()
+			}
+
+			inputs = append(inputs, input)
+
+			return nil
+		},
+	)
+
+	record["inputs"] = inputs
+
+	return err
+}
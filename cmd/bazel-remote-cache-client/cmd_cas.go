@@ -13,6 +13,7 @@ func newCASCmd(app *application) *cobra.Command {
 
 	cmd.AddCommand(
 		newCASGetCmd(app),
+		newCASPutCmd(app),
 	)
 
 	return &cmd
@@ -2,9 +2,15 @@ package main
 
 import (
 	"bufio"
+	"bytes"
+	"context"
+	"errors"
 	"fmt"
 	"io"
 	"os"
+	"path/filepath"
+	"strings"
+	"sync"
 
 	"github.com/spf13/cobra"
 
@@ -13,69 +19,78 @@ import (
 
 func newCASGetCmd(app *application) *cobra.Command {
 	var (
-		digest         *bzlremotecache.Digest
+		targets        []blobTarget
 		outputFilePath string
+		outputDirPath  string
 		isExecutable   bool
+		jobs           int
 	)
 
 	cmd := cobra.Command{
-		Use:   "get [flags] <digest> ...",
+		Use:   "get [flags] <digest>[=<path>] ...",
 		Short: "Get output file from remote Bazel cache",
 		Args:  cobra.MinimumNArgs(1),
 		PreRunE: func(cmd *cobra.Command, args []string) error {
-			var err error
+			targets = make([]blobTarget, len(args))
+			for i, arg := range args {
+				var err error
 
-			digest, err = bzlremotecache.ParseDigestFromString(args[0])
-			if err != nil {
-				return err
+				targets[i], err = parseBlobTarget(arg)
+				if err != nil {
+					return err
+				}
+			}
+
+			if outputDirPath == "" {
+				if len(targets) > 1 {
+					return errors.New("several digests given, an output directory is required")
+				}
+
+				if targets[0].path != "" {
+					return errors.New("a digest path is given, an output directory is required")
+				}
+			} else if outputFilePath != "" {
+				return errors.New("an output file and an output directory can't be both given")
+			}
+
+			if outputDirPath == "" && outputFilePath == "" && app.OutputFormat.IsStructured() {
+				return fmt.Errorf(
+					"the blob content can't be printed with the %s output, an output file or directory is required",
+					app.OutputFormat,
+				)
+			}
+
+			if jobs < 1 {
+				return errors.New("the number of jobs must be positive")
 			}
 
 			return nil
 		},
 		RunE: func(cmd *cobra.Command, args []string) error {
-			content, err := app.BazelRemoteCache.GetBlob(cmd.Context(), digest)
-			if err != nil {
-				return err
+			if outputDirPath != "" {
+				return getBlobs(cmd.Context(), app, targets, outputDirPath, isExecutable, jobs)
 			}
 
-			var output io.Writer
-			if outputFilePath == "" {
-				output = os.Stdout
-			} else {
-				var perm os.FileMode
-				if isExecutable {
-					perm = 0755
-				} else {
-					perm = 0644
-				}
-
-				f, err := os.OpenFile(
-					outputFilePath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, perm,
-				)
+			digest := targets[0].digest
 
-				if err != nil {
-					return fmt.Errorf("failed to open the output file: %v", err)
+			if outputFilePath != "" {
+				err := downloadBlob(cmd.Context(), app, digest, outputFilePath, isExecutable)
+				if !app.OutputFormat.IsStructured() {
+					return err
 				}
 
-				defer func() {
-					if err := f.Close(); err != nil {
-						_, _ = fmt.Fprintf(
-							os.Stderr, "Warning: Can't close the output file: %v\n", err,
-						)
-					}
-				}()
-
-				output = f
+				target := blobTarget{digest: digest, path: outputFilePath}
+				return printBlobRecords(app, []blobTarget{target}, []error{err})
 			}
 
-			outputBuf := bufio.NewWriter(output)
+			outputBuf := bufio.NewWriter(os.Stdout)
 
-			if _, err := outputBuf.Write(content); err != nil {
-				return fmt.Errorf("can't write the output file: %v", err)
+			if err := app.BazelRemoteCache.ReadBlob(cmd.Context(), digest, outputBuf); err != nil {
+				return err
 			}
 
 			if err := outputBuf.Flush(); err != nil {
-				return fmt.Errorf("can't flush the output file: %v", err)
+				return fmt.Errorf("can't flush the output: %v", err)
 			}
 
 			return nil
@@ -84,13 +99,349 @@ func newCASGetCmd(app *application) *cobra.Command {
 
 	fl := cmd.Flags()
 	fl.StringVarP(
-		&outputFilePath, "output", "o", "",
-		"Output file to write the blob",
+		&outputFilePath, "output-file", "o", "",
+		"Output file to write the blob, interrupted downloads are resumed",
+	)
+	fl.StringVarP(
+		&outputDirPath, "output-dir", "d", "",
+		"Output directory to write the blobs, named by their hash or their given path",
 	)
 	fl.BoolVarP(
 		&isExecutable, "exec", "x", false,
 		"The blob content is executable",
 	)
+	fl.IntVarP(
+		&jobs, "jobs", "j", 4,
+		"Number of concurrent downloads of large blobs",
+	)
 
 	return app.newRemoteCacheCommand(&cmd)
 }
+
+// blobTarget is a blob to download with its output path.
+type blobTarget struct {
+	digest       *bzlremotecache.Digest
+	path         string
+	isExecutable bool
+}
+
+// parseBlobTarget parses a blob target in the form <hash>/<size>[=<path>].
+func parseBlobTarget(s string) (blobTarget, error) {
+	rawDigest, path, _ := strings.Cut(s, "=")
+
+	digest, err := bzlremotecache.ParseDigestFromString(rawDigest)
+	if err != nil {
+		return blobTarget{}, err
+	}
+
+	return blobTarget{
+		digest: digest,
+		path:   path,
+	}, nil
+}
+
+// getBlobs downloads the given blobs in the output directory
+// and prints the result of each download.
+func getBlobs(
+	ctx context.Context, app *application, targets []blobTarget,
+	outputDirPath string, isExecutable bool, jobs int,
+) error {
+	outputTargets := make([]blobTarget, len(targets))
+	for i, target := range targets {
+		outputTargets[i] = blobTarget{
+			digest:       target.digest,
+			path:         filepath.Join(outputDirPath, target.digest.Hash),
+			isExecutable: isExecutable,
+		}
+
+		if target.path != "" {
+			outputTargets[i].path = filepath.Join(outputDirPath, target.path)
+		}
+	}
+
+	errs := downloadBlobs(ctx, app, outputTargets, jobs)
+
+	if app.OutputFormat.IsStructured() {
+		return printBlobRecords(app, outputTargets, errs)
+	}
+
+	var hasError bool
+	for i, target := range targets {
+		if errs[i] != nil {
+			fmt.Printf(
+				"%s: %s\n",
+				acDigestColor.Sprint(target.digest),
+				errorColor.Sprint(app.BazelRemoteCache.ErrorMsg(errs[i])),
+			)
+			hasError = true
+		} else {
+			fmt.Printf(
+				"%s: %s\n",
+				acDigestColor.Sprint(target.digest),
+				cyanColor.Sprint(outputTargets[i].path),
+			)
+		}
+	}
+
+	if hasError {
+		return errors.New("all blobs haven't been retrieved")
+	}
+
+	return nil
+}
+
+// printBlobRecords prints the result of each blob download
+// with a structured output.
+func printBlobRecords(app *application, targets []blobTarget, errs []error) error {
+	records := newRecordWriter(app.OutputFormat)
+
+	var hasError bool
+	for i, target := range targets {
+		record := map[string]interface{}{
+			"digest": target.digest.String(),
+			"path":   target.path,
+		}
+
+		if errs[i] != nil {
+			record["error"] = app.BazelRemoteCache.ErrorMsg(errs[i])
+			hasError = true
+		}
+
+		if err := records.Write(record); err != nil {
+			return err
+		}
+	}
+
+	if err := records.Close(); err != nil {
+		return err
+	}
+
+	if hasError {
+		return errors.New("all blobs haven't been retrieved")
+	}
+
+	return nil
+}
+
+// downloadBlobs downloads the given blobs in their output file and returns
+// the error of each download. Small blobs are read together with batch
+// requests while large ones are concurrently streamed. The targets of the
+// same output file are only downloaded once, and fail if their blobs differ.
+func downloadBlobs(ctx context.Context, app *application, targets []blobTarget, jobs int) []error {
+	errs := make([]error, len(targets))
+
+	var (
+		batched    []*bzlremotecache.Digest
+		batchIdx   []int
+		streamIdx  []int
+		streamJobs = make(chan int)
+		// pathIdx is the index of the downloaded target of each path.
+		pathIdx = make(map[string]int, len(targets))
+		// sameIdx is the index of the downloaded target of the same
+		// blob and path of each duplicate target.
+		sameIdx = make(map[int]int)
+	)
+
+	for i, target := range targets {
+		if j, ok := pathIdx[target.path]; ok {
+			if *targets[j].digest != *target.digest {
+				errs[i] = fmt.Errorf("conflicting blobs %s and %s for the same output file", targets[j].digest, target.digest)
+			} else {
+				sameIdx[i] = j
+			}
+
+			continue
+		}
+
+		pathIdx[target.path] = i
+
+		if err := os.MkdirAll(filepath.Dir(target.path), 0755); err != nil {
+			errs[i] = fmt.Errorf("can't create the output directory: %v", err)
+		} else if app.BazelRemoteCache.IsBatchable(ctx, target.digest) {
+			batched = append(batched, target.digest)
+			batchIdx = append(batchIdx, i)
+		} else {
+			streamIdx = append(streamIdx, i)
+		}
+	}
+
+	var wg sync.WaitGroup
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+
+		if len(batched) == 0 {
+			return
+		}
+
+		// The blobs are written as each batch returns,
+		// to not keep all of them in memory.
+		app.BazelRemoteCache.GetBlobsFunc(ctx, batched, func(j int, r bzlremotecache.BlobResult) {
+			i := batchIdx[j]
+			if r.Err != nil {
+				errs[i] = r.Err
+			} else {
+				errs[i] = writeBlob(targets[i].path, r.Digest, r.Data, targets[i].isExecutable)
+			}
+		})
+	}()
+
+	for w := 0; w < jobs; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			for i := range streamJobs {
+				errs[i] = downloadBlob(ctx, app, targets[i].digest, targets[i].path, targets[i].isExecutable)
+			}
+		}()
+	}
+
+	for _, i := range streamIdx {
+		streamJobs <- i
+	}
+	close(streamJobs)
+
+	wg.Wait()
+
+	for i, j := range sameIdx {
+		errs[i] = errs[j]
+	}
+
+	return errs
+}
+
+// writeBlob writes the content of a blob in the given output file
+// after checking that it matches the digest.
+func writeBlob(outputFilePath string, digest *bzlremotecache.Digest, data []byte, isExecutable bool) error {
+	actual, err := bzlremotecache.ComputeDigest(bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+
+	if *actual != *digest {
+		return fmt.Errorf("digest mismatch: expected %s, got %s", digest, actual)
+	}
+
+	perm := fileMode(isExecutable)
+
+	// An existing symlink is replaced instead of being followed.
+	if err := os.Remove(outputFilePath); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("can't replace the output file: %v", err)
+	}
+
+	if err := os.WriteFile(outputFilePath, data, perm); err != nil {
+		return fmt.Errorf("can't write the output file: %v", err)
+	}
+
+	if err := os.Chmod(outputFilePath, perm); err != nil {
+		return fmt.Errorf("can't change the output file mode: %v", err)
+	}
+
+	return nil
+}
+
+// fileMode returns the mode of a downloaded file.
+func fileMode(isExecutable bool) os.FileMode {
+	if isExecutable {
+		return 0755
+	}
+
+	return 0644
+}
+
+// downloadBlob downloads a blob into the given output file.
+//
+// The content is first written in a partial file next to the output file,
+// which is used to resume the download if it was interrupted. The partial
+// file is renamed into place once its content matches the digest.
+func downloadBlob(
+	ctx context.Context, app *application, digest *bzlremotecache.Digest,
+	outputFilePath string, isExecutable bool,
+) error {
+	perm := fileMode(isExecutable)
+
+	partFilePath := outputFilePath + ".part"
+
+	f, err := os.OpenFile(partFilePath, os.O_WRONLY|os.O_CREATE, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to open the output file: %v", err)
+	}
+
+	defer func() {
+		if err := f.Close(); err != nil && !errors.Is(err, os.ErrClosed) {
+			_, _ = fmt.Fprintf(
+				os.Stderr, "Warning: Can't close the output file: %v\n", err,
+			)
+		}
+	}()
+
+	offset, err := f.Seek(0, io.SeekEnd)
+	if err != nil {
+		return fmt.Errorf("can't seek the output file: %v", err)
+	}
+
+	if offset > digest.Size {
+		if err := f.Truncate(0); err != nil {
+			return fmt.Errorf("can't truncate the output file: %v", err)
+		}
+
+		if offset, err = f.Seek(0, io.SeekStart); err != nil {
+			return fmt.Errorf("can't seek the output file: %v", err)
+		}
+	}
+
+	outputBuf := bufio.NewWriter(f)
+
+	_, err = app.BazelRemoteCache.ReadBlobFrom(ctx, digest, offset, outputBuf)
+	if flushErr := outputBuf.Flush(); err == nil && flushErr != nil {
+		err = fmt.Errorf("can't write the output file: %v", flushErr)
+	}
+
+	if err != nil {
+		return fmt.Errorf("download interrupted, run again to resume it: %w", err)
+	}
+
+	if err := f.Close(); err != nil {
+		return fmt.Errorf("can't close the output file: %v", err)
+	}
+
+	if err := verifyFileDigest(partFilePath, digest); err != nil {
+		_ = os.Remove(partFilePath)
+		return err
+	}
+
+	if err := os.Chmod(partFilePath, perm); err != nil {
+		return fmt.Errorf("can't change the output file mode: %v", err)
+	}
+
+	if err := os.Rename(partFilePath, outputFilePath); err != nil {
+		return fmt.Errorf("can't rename the output file: %v", err)
+	}
+
+	return nil
+}
+
+// verifyFileDigest checks that the content of the given file matches the digest.
+func verifyFileDigest(filePath string, digest *bzlremotecache.Digest) error {
+	f, err := os.Open(filePath)
+	if err != nil {
+		return fmt.Errorf("can't open the output file: %v", err)
+	}
+
+	defer func() {
+		_ = f.Close()
+	}()
+
+	actual, err := bzlremotecache.ComputeDigest(bufio.NewReader(f))
+	if err != nil {
+		return fmt.Errorf("can't read the output file: %v", err)
+	}
+
+	if *actual != *digest {
+		return fmt.Errorf("digest mismatch: expected %s, got %s", digest, actual)
+	}
+
+	return nil
+}
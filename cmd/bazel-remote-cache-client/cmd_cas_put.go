@@ -0,0 +1,165 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/spf13/cobra"
+
+	"github.com/leboncoin/bazel-remote-cache-client/pkg/bzlremotecache"
+)
+
+func newCASPutCmd(app *application) *cobra.Command {
+	var jobs int
+
+	cmd := cobra.Command{
+		Use:   "put [flags] <file|dir>...",
+		Short: "Upload files and directories to the remote Bazel cache",
+		Args:  cobra.MinimumNArgs(1),
+		PreRunE: func(cmd *cobra.Command, args []string) error {
+			if jobs < 1 {
+				return errors.New("the number of jobs must be positive")
+			}
+
+			return nil
+		},
+		RunE: func(cmd *cobra.Command, args []string) error {
+			sources := make([]blobSource, len(args))
+
+			var blobs []*bzlremotecache.Blob
+			for i, arg := range args {
+				var err error
+
+				sources[i], err = readBlobSource(arg)
+				if err != nil {
+					return err
+				}
+
+				blobs = append(blobs, sources[i].blobs...)
+			}
+
+			uploaded, err := app.BazelRemoteCache.UploadBlobs(cmd.Context(), blobs, jobs)
+			if err != nil {
+				return err
+			}
+
+			if app.OutputFormat.IsStructured() {
+				records := newRecordWriter(app.OutputFormat)
+				for _, source := range sources {
+					if err := records.Write(source.record()); err != nil {
+						return err
+					}
+				}
+
+				return records.Close()
+			}
+
+			for _, source := range sources {
+				if source.treeDigest == nil {
+					fmt.Printf("%s: %s\n", cyanColor.Sprint(source.path), acDigestColor.Sprint(source.digest))
+				} else {
+					fmt.Printf(
+						"%s: %s %s\n",
+						cyanColor.Sprint(source.path),
+						acDigestColor.Sprint(source.digest),
+						faintColor.Sprintf("(tree %s)", source.treeDigest),
+					)
+				}
+			}
+
+			var uploadedSize int64
+			for _, blob := range uploaded {
+				uploadedSize += blob.Digest.Size
+			}
+
+			fmt.Println(faintColor.Sprintf(
+				"%d blobs uploaded (%s), %d already in the cache",
+				len(uploaded), formatBytes(uploadedSize), countUniqueBlobs(blobs)-len(uploaded),
+			))
+
+			return nil
+		},
+		Example: `  To upload a file and a directory:
+	$ bazel-remote-cache-client cas put --remote localhost:9092 bazel-bin/app.tar bazel-bin/docs
+
+  The digest of a directory is the digest of its Directory proto, used as input root,
+  followed by the digest of its Tree proto, used as output directory.`,
+	}
+
+	fl := cmd.Flags()
+	fl.IntVarP(
+		&jobs, "jobs", "j", 4,
+		"Number of concurrent uploads of large blobs",
+	)
+
+	return app.newRemoteCacheCommand(&cmd)
+}
+
+// blobSource is a local file or directory to upload.
+type blobSource struct {
+	path string
+	// digest is the digest of the file or of the Directory proto
+	// of the directory.
+	digest *bzlremotecache.Digest
+	// treeDigest is the digest of the Tree proto of the directory.
+	treeDigest *bzlremotecache.Digest
+	blobs      []*bzlremotecache.Blob
+}
+
+// readBlobSource computes the blobs of a local file or directory.
+func readBlobSource(path string) (blobSource, error) {
+	fi, err := os.Stat(path)
+	if err != nil {
+		return blobSource{}, err
+	}
+
+	if !fi.IsDir() {
+		blob, err := bzlremotecache.NewFileBlob(path)
+		if err != nil {
+			return blobSource{}, err
+		}
+
+		return blobSource{
+			path:   path,
+			digest: blob.Digest,
+			blobs:  []*bzlremotecache.Blob{blob},
+		}, nil
+	}
+
+	ld, err := bzlremotecache.ReadLocalDirectory(path)
+	if err != nil {
+		return blobSource{}, fmt.Errorf("can't read the directory %s: %v", path, err)
+	}
+
+	return blobSource{
+		path:       path,
+		digest:     ld.RootDigest,
+		treeDigest: ld.TreeDigest,
+		blobs:      ld.Blobs,
+	}, nil
+}
+
+// record returns the record of the source printed with a structured output.
+func (s *blobSource) record() map[string]interface{} {
+	record := map[string]interface{}{
+		"path":   s.path,
+		"digest": s.digest.String(),
+	}
+
+	if s.treeDigest != nil {
+		record["tree_digest"] = s.treeDigest.String()
+	}
+
+	return record
+}
+
+// countUniqueBlobs returns the number of distinct blobs.
+func countUniqueBlobs(blobs []*bzlremotecache.Blob) int {
+	digests := make(map[bzlremotecache.Digest]bool, len(blobs))
+	for _, blob := range blobs {
+		digests[*blob.Digest] = true
+	}
+
+	return len(digests)
+}
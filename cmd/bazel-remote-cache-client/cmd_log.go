@@ -1,32 +1,60 @@
 package main
 
 import (
-	"bufio"
-	"encoding/binary"
+	"context"
 	"errors"
 	"fmt"
 	"io"
 	"os"
+	"os/signal"
+	"time"
 
 	"github.com/spf13/cobra"
-	"google.golang.org/protobuf/proto"
 
 	"github.com/leboncoin/bazel-remote-cache-client/pkg/bzlremotelogging"
 )
 
-func newLogCmd(_ *application) *cobra.Command {
+func newLogCmd(app *application) *cobra.Command {
 	var (
 		showMetadata bool
+		follow       bool
+		recoverFlag  bool
+		filter       logFilter
 	)
 
 	cmd := cobra.Command{
-		Use:   "log [flags] <filepath>...",
+		Use:   "log [flags] <filepath|->...",
 		Short: "Print in a human-readable format a gRPC remote execution log file",
 		Args:  cobra.MinimumNArgs(1),
+		PreRunE: func(cmd *cobra.Command, args []string) error {
+			if follow && len(args) > 1 {
+				return errors.New("only one log file can be followed")
+			}
+
+			return filter.compile()
+		},
 		RunE: func(cmd *cobra.Command, args []string) error {
+			ctx := cmd.Context()
+			if follow {
+				var stop context.CancelFunc
+				ctx, stop = signal.NotifyContext(ctx, os.Interrupt)
+				defer stop()
+			}
+
+			opts := logReadOptions{
+				filter:  &filter,
+				follow:  follow,
+				recover: recoverFlag,
+			}
+
+			var records *recordWriter
+			if app.OutputFormat.IsStructured() {
+				records = newRecordWriter(app.OutputFormat)
+			}
+
 			var count int
 			for _, logFilePath := range args {
-				if len(args) > 1 {
+				if len(args) > 1 && records == nil {
 					if count > 0 {
 						fmt.Println()
 					}
@@ -34,13 +62,17 @@ func newLogCmd(_ *application) *cobra.Command {
 					fmt.Printf("%s\n------\n", logFilePath)
 				}
 
-				if err := printLogFile(logFilePath, showMetadata); err != nil {
+				if err := printLogFile(ctx, logFilePath, opts, showMetadata, records); err != nil {
 					return err
 				}
 
 				count++
 			}
 
+			if records != nil {
+				return records.Close()
+			}
+
 			return nil
 		},
 		Example: `  To generate a log file:
@@ -50,7 +82,17 @@ func newLogCmd(_ *application) *cobra.Command {
 	    //...
 
   To parse this log file:
-	$ bazel-remote-cache-client log /tmp/grpc.log`,
+	$ bazel-remote-cache-client log /tmp/grpc.log
+
+  To parse a compressed log file from the standard input:
+	$ ssh ci cat /var/log/bazel/grpc.log.zst | bazel-remote-cache-client log -
+
+  To print the entries of a running build as soon as they are written:
+	$ bazel-remote-cache-client log --follow /tmp/grpc.log
+
+  To only show the slow cache misses of a package:
+	$ bazel-remote-cache-client log --status NOT_FOUND --target //foo/... \
+	    --min-duration 1s /tmp/grpc.log`,
 	}
 
 	fl := cmd.Flags()
@@ -58,22 +100,41 @@ func newLogCmd(_ *application) *cobra.Command {
 		&showMetadata, "show-metadata", "m", false,
 		"Show metadata of all log entries",
 	)
+	fl.BoolVarP(
+		&follow, "follow", "f", false,
+		"Wait for new entries at the end of the log file, until interrupted",
+	)
+	fl.BoolVar(
+		&recoverFlag, "recover", false,
+		"Skip the corrupt or truncated entries instead of failing",
+	)
+	filter.addFlags(&cmd)
+
+	cmd.AddCommand(
+		newLogDiffCmd(app),
+		newLogExportCmd(app),
+		newLogStatsCmd(app),
+	)
 
 	return &cmd
 }
 
-func printLogFile(logFilePath string, showMetadata bool) error {
-	logFile, err := os.Open(logFilePath)
-	if err != nil {
-		return fmt.Errorf("can't open file %q: %v", logFilePath, err)
-	}
+// printLogFile prints the entries of a log file, as records if the given
+// record writer isn't nil.
+func printLogFile(
+	ctx context.Context, logFilePath string, opts logReadOptions, showMetadata bool, records *recordWriter,
+) error {
+	var count int
+	return readLogFile(ctx, logFilePath, opts, func(le *bzlremotelogging.LogEntry) error {
+		if records != nil {
+			record, err := protoRecord(le)
+			if err != nil {
+				return err
+			}
 
-	defer func() {
-		_ = logFile.Close()
-	}()
+			return records.Write(record)
+		}
 
-	var count int
-	return readStreamProtoLog(logFile, func(le *bzlremotelogging.LogEntry) {
 		if count > 0 {
 			fmt.Println()
 		}
@@ -81,37 +142,171 @@ func printLogFile(logFilePath string, showMetadata bool) error {
 		printLogEntry(le, showMetadata)
 
 		count++
+
+		return nil
 	})
 }
 
-func readStreamProtoLog(r io.Reader, processLogFunc func(le *bzlremotelogging.LogEntry)) error {
-	buf := make([]byte, 0, 4096)
+// followPollInterval is the time waited for new bytes at the end of a
+// followed log file.
+const followPollInterval = 200 * time.Millisecond
+
+// logReadOptions defines how a log file is read.
+type logReadOptions struct {
+	// filter selects the entries to process, all of them if nil.
+	filter *logFilter
+	// follow waits for new entries at the end of the file until the context
+	// is done.
+	follow bool
+	// recover skips the corrupt entries instead of failing.
+	recover bool
+}
+
+// readLogFile calls processLogFunc for each entry of a log file, which may be
+// compressed with gzip or zstd. The path "-" reads the standard input.
+func readLogFile(
+	ctx context.Context, logFilePath string, opts logReadOptions,
+	processLogFunc func(le *bzlremotelogging.LogEntry) error,
+) error {
+	logFile := os.Stdin
+	if logFilePath != "-" {
+		var err error
+		if logFile, err = os.Open(logFilePath); err != nil {
+			return fmt.Errorf("can't open file %q: %v", logFilePath, err)
+		}
+
+		defer func() {
+			_ = logFile.Close()
+		}()
+	}
+
+	var r io.Reader = logFile
+	if opts.follow {
+		r = &followReader{
+			ctx:      ctx,
+			r:        logFile,
+			interval: followPollInterval,
+		}
+	}
+
+	dr, err := newDecompressingReader(r)
+	if err != nil {
+		return fmt.Errorf("can't read file %q: %v", logFilePath, err)
+	}
+
+	defer func() {
+		_ = dr.Close()
+	}()
+
+	regions, err := readStreamProtoLog(dr, opts, processLogFunc)
+
+	if len(regions) > 0 {
+		var skipped int64
+		for _, region := range regions {
+			skipped += region.size
+		}
+
+		_, _ = fmt.Fprintf(
+			os.Stderr, "Warning: Skipped %d corrupt bytes in %d regions of %q\n",
+			skipped, len(regions), logFilePath,
+		)
+	}
+
+	if err != nil && opts.follow && ctx.Err() != nil {
+		// Interrupted while waiting for the end of a record.
+		return nil
+	}
+
+	return err
+}
+
+// followReader reads a growing file like tail -f: at the end of the file,
+// it waits for more bytes instead of returning io.EOF, until its context
+// is done. This way, a partially written record is read once complete.
+type followReader struct {
+	ctx      context.Context
+	r        io.Reader
+	interval time.Duration
+}
 
-	br := bufio.NewReader(r)
+func (fr *followReader) Read(p []byte) (int, error) {
 	for {
-		size, err := binary.ReadUvarint(br)
-		if err != nil {
-			if errors.Is(err, io.EOF) {
-				return nil
-			}
-			return err
+		n, err := fr.r.Read(p)
+		if n > 0 || !errors.Is(err, io.EOF) {
+			return n, err
 		}
 
-		if int(size) > cap(buf) {
-			buf = make([]byte, 0, size)
+		select {
+		case <-fr.ctx.Done():
+			return 0, io.EOF
+		case <-time.After(fr.interval):
+		}
+	}
+}
+
+// readStreamProtoLog calls processLogFunc for each entry of a log stream
+// matching the filter. On a corrupt or truncated entry, it returns an error
+// with the offset and the index of the entry, unless in recovery mode where
+// it resynchronizes on the next decodable entry and returns the skipped regions.
+func readStreamProtoLog(
+	r io.Reader, opts logReadOptions, processLogFunc func(le *bzlremotelogging.LogEntry) error,
+) ([]corruptRegion, error) {
+	var (
+		regions []corruptRegion
+		index   int
+	)
+
+	lr := newLogReader(r)
+	for {
+		var le bzlremotelogging.LogEntry
+
+		n, err := lr.next(&le)
+		if errors.Is(err, io.EOF) {
+			return regions, nil
+		}
+
+		if lr.err != nil {
+			return regions, lr.err
 		}
-		buf = buf[:size]
 
-		_, err = io.ReadFull(br, buf)
 		if err != nil {
-			return err
+			if !opts.recover {
+				return regions, fmt.Errorf("can't read log entry #%d at offset %d: %v", index+1, lr.offset, err)
+			}
+
+			region := corruptRegion{
+				offset: lr.offset,
+				index:  index,
+				err:    err,
+			}
+
+			n, err = lr.resync(&le)
+			region.size = lr.offset - region.offset
+			regions = append(regions, region)
+
+			_, _ = fmt.Fprintf(
+				os.Stderr, "Warning: Skipped %d bytes of log entry #%d at offset %d: %v\n",
+				region.size, index+1, region.offset, region.err,
+			)
+
+			if errors.Is(err, io.EOF) {
+				return regions, nil
+			}
+
+			if lr.err != nil {
+				return regions, lr.err
+			}
 		}
 
-		var le bzlremotelogging.LogEntry
-		if err := proto.Unmarshal(buf, &le); err != nil {
-			return err
+		lr.skip(n)
+		index++
+
+		if !opts.filter.match(&le) {
+			continue
 		}
 
-		processLogFunc(&le)
+		if err := processLogFunc(&le); err != nil {
+			return regions, err
+		}
 	}
 }
@@ -0,0 +1,404 @@
+package main
+
+import (
+	"context"
+	"errors"
+
+	"github.com/spf13/cobra"
+	"google.golang.org/grpc/codes"
+
+	"github.com/leboncoin/bazel-remote-cache-client/pkg/bzlremotecache"
+	"github.com/leboncoin/bazel-remote-cache-client/pkg/bzlremotelogging"
+)
+
+func newLogDiffCmd(app *application) *cobra.Command {
+	var (
+		recoverFlag bool
+	)
+
+	cmd := cobra.Command{
+		Use:   "diff [flags] <filepath-a> <filepath-b>",
+		Short: "Show the cache hits and misses which differ between two gRPC log files",
+		Args:  cobra.ExactArgs(2),
+		PreRunE: func(cmd *cobra.Command, args []string) error {
+			if args[0] == "-" && args[1] == "-" {
+				return errors.New("the standard input can't be read for both log files")
+			}
+
+			return nil
+		},
+		RunE: func(cmd *cobra.Command, args []string) error {
+			runA, err := readLoggedRun(cmd.Context(), args[0], recoverFlag)
+			if err != nil {
+				return err
+			}
+
+			runB, err := readLoggedRun(cmd.Context(), args[1], recoverFlag)
+			if err != nil {
+				return err
+			}
+
+			diff := diffLoggedRuns(runA, runB)
+
+			if app.OutputFormat.IsStructured() {
+				records := newRecordWriter(app.OutputFormat)
+				if err := records.Write(diff.record()); err != nil {
+					return err
+				}
+
+				return records.Close()
+			}
+
+			printLogDiff(diff)
+
+			return nil
+		},
+		Example: `  To understand why a local build missed the cache while the CI hit it:
+	$ bazel-remote-cache-client log diff /tmp/ci.log /tmp/local.log`,
+	}
+
+	fl := cmd.Flags()
+	fl.BoolVar(
+		&recoverFlag, "recover", false,
+		"Skip the corrupt or truncated entries instead of failing",
+	)
+
+	return &cmd
+}
+
+// loggedAction contains what has been logged about an action.
+type loggedAction struct {
+	targetID string
+	mnemonic string
+	actionID string
+
+	// digests are the action digests requested with GetActionResult.
+	digests []*bzlremotecache.Digest
+	// cacheHit is true if a GetActionResult call returned an action result.
+	cacheHit bool
+	// cacheMiss is true if a GetActionResult call failed.
+	cacheMiss bool
+}
+
+// isLookedUp reports whether the action result has been requested.
+func (a *loggedAction) isLookedUp() bool {
+	return a.cacheHit || a.cacheMiss
+}
+
+func (a *loggedAction) hasDigest(digest *bzlremotecache.Digest) bool {
+	for _, d := range a.digests {
+		if *d == *digest {
+			return true
+		}
+	}
+
+	return false
+}
+
+// sameDigests reports whether the actions requested the same digests.
+func (a *loggedAction) sameDigests(other *loggedAction) bool {
+	if len(a.digests) != len(other.digests) {
+		return false
+	}
+
+	for _, d := range a.digests {
+		if !other.hasDigest(d) {
+			return false
+		}
+	}
+
+	return true
+}
+
+type loggedActionKey struct {
+	targetID string
+	mnemonic string
+	actionID string
+}
+
+// uploadedBlob is a blob written with ByteStream by an action.
+type uploadedBlob struct {
+	digest *bzlremotecache.Digest
+	action *loggedAction
+}
+
+// loggedRun contains the actions and the uploads of a log file.
+type loggedRun struct {
+	path    string
+	actions []*loggedAction
+	uploads []uploadedBlob
+}
+
+// readLoggedRun reads a log file and groups its entries by action, using
+// their request metadata.
+func readLoggedRun(ctx context.Context, logFilePath string, resync bool) (*loggedRun, error) {
+	run := loggedRun{
+		path: logFilePath,
+	}
+
+	actions := make(map[loggedActionKey]*loggedAction)
+	uploaded := make(map[bzlremotecache.Digest]bool)
+
+	err := readLogFile(ctx, logFilePath, logReadOptions{recover: resync}, func(le *bzlremotelogging.LogEntry) error {
+		md := le.GetMetadata()
+		if md.GetTargetId() == "" && md.GetActionMnemonic() == "" && md.GetActionId() == "" {
+			return nil
+		}
+
+		key := loggedActionKey{
+			targetID: md.GetTargetId(),
+			mnemonic: md.GetActionMnemonic(),
+			actionID: md.GetActionId(),
+		}
+
+		action, ok := actions[key]
+		if !ok {
+			action = &loggedAction{
+				targetID: key.targetID,
+				mnemonic: key.mnemonic,
+				actionID: key.actionID,
+			}
+			actions[key] = action
+			run.actions = append(run.actions, action)
+		}
+
+		code := codes.Code(le.GetStatus().GetCode())
+
+		switch details := le.GetDetails().GetDetails().(type) {
+		case *bzlremotelogging.RpcCallDetails_GetActionResult:
+			if d := details.GetActionResult.GetRequest().GetActionDigest(); d != nil {
+				if digest := bzlremotecache.DigestFromProto(d); !action.hasDigest(digest) {
+					action.digests = append(action.digests, digest)
+				}
+			}
+
+			if code == codes.OK {
+				action.cacheHit = true
+			} else {
+				action.cacheMiss = true
+			}
+		case *bzlremotelogging.RpcCallDetails_Write:
+			if code != codes.OK {
+				break
+			}
+
+			for _, resourceName := range details.Write.GetResourceNames() {
+				digest, err := bzlremotecache.ParseDigestFromResourceName(resourceName)
+				if err != nil || uploaded[*digest] {
+					continue
+				}
+
+				uploaded[*digest] = true
+				run.uploads = append(run.uploads, uploadedBlob{digest: digest, action: action})
+			}
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &run, nil
+}
+
+// actionPair is an action found in both log files.
+type actionPair struct {
+	a, b *loggedAction
+}
+
+// logDiff contains the differences between two log files.
+type logDiff struct {
+	runA, runB *loggedRun
+
+	changedDigests []actionPair
+	hitOnlyInA     []actionPair
+	hitOnlyInB     []actionPair
+	onlyInA        []*loggedAction
+	onlyInB        []*loggedAction
+	uploadsOnlyInA []uploadedBlob
+	uploadsOnlyInB []uploadedBlob
+}
+
+// IsEmpty reports whether no difference has been found.
+func (d *logDiff) IsEmpty() bool {
+	return len(d.changedDigests) == 0 && len(d.hitOnlyInA) == 0 && len(d.hitOnlyInB) == 0 &&
+		len(d.onlyInA) == 0 && len(d.onlyInB) == 0 &&
+		len(d.uploadsOnlyInA) == 0 && len(d.uploadsOnlyInB) == 0
+}
+
+// diffLoggedRuns correlates the actions of two runs and returns their
+// differences.
+//
+// Actions are correlated by target and mnemonic. As the action ID may change
+// with the action digest, the actions of a target sharing the same mnemonic
+// are matched by action ID first, then in their order of appearance.
+func diffLoggedRuns(runA, runB *loggedRun) *logDiff {
+	diff := logDiff{
+		runA: runA,
+		runB: runB,
+	}
+
+	type groupKey struct {
+		targetID string
+		mnemonic string
+	}
+
+	groupsB := make(map[groupKey][]*loggedAction)
+	for _, action := range runB.actions {
+		key := groupKey{action.targetID, action.mnemonic}
+		groupsB[key] = append(groupsB[key], action)
+	}
+
+	matchedB := make(map[*loggedAction]bool)
+	var pairs []actionPair
+	var unmatchedA []*loggedAction
+
+	// Match by action ID.
+	for _, action := range runA.actions {
+		var match *loggedAction
+		for _, candidate := range groupsB[groupKey{action.targetID, action.mnemonic}] {
+			if !matchedB[candidate] && candidate.actionID == action.actionID {
+				match = candidate
+				break
+			}
+		}
+
+		if match == nil {
+			unmatchedA = append(unmatchedA, action)
+			continue
+		}
+
+		matchedB[match] = true
+		pairs = append(pairs, actionPair{action, match})
+	}
+
+	// Match the remaining actions in their order of appearance.
+	for _, action := range unmatchedA {
+		var match *loggedAction
+		for _, candidate := range groupsB[groupKey{action.targetID, action.mnemonic}] {
+			if !matchedB[candidate] {
+				match = candidate
+				break
+			}
+		}
+
+		if match == nil {
+			diff.onlyInA = append(diff.onlyInA, action)
+			continue
+		}
+
+		matchedB[match] = true
+		pairs = append(pairs, actionPair{action, match})
+	}
+
+	for _, action := range runB.actions {
+		if !matchedB[action] {
+			diff.onlyInB = append(diff.onlyInB, action)
+		}
+	}
+
+	for _, pair := range pairs {
+		if !pair.a.isLookedUp() || !pair.b.isLookedUp() {
+			continue
+		}
+
+		if !pair.a.sameDigests(pair.b) {
+			diff.changedDigests = append(diff.changedDigests, pair)
+		}
+
+		switch {
+		case pair.a.cacheHit && !pair.b.cacheHit:
+			diff.hitOnlyInA = append(diff.hitOnlyInA, pair)
+		case !pair.a.cacheHit && pair.b.cacheHit:
+			diff.hitOnlyInB = append(diff.hitOnlyInB, pair)
+		}
+	}
+
+	diff.uploadsOnlyInA = uploadsOnlyIn(runA, runB)
+	diff.uploadsOnlyInB = uploadsOnlyIn(runB, runA)
+
+	return &diff
+}
+
+// uploadsOnlyIn returns the blobs uploaded in run but not in other.
+func uploadsOnlyIn(run, other *loggedRun) []uploadedBlob {
+	uploaded := make(map[bzlremotecache.Digest]bool, len(other.uploads))
+	for _, upload := range other.uploads {
+		uploaded[*upload.digest] = true
+	}
+
+	var uploads []uploadedBlob
+	for _, upload := range run.uploads {
+		if !uploaded[*upload.digest] {
+			uploads = append(uploads, upload)
+		}
+	}
+
+	return uploads
+}
+
+// record returns the record of the differences printed with a structured output.
+func (d *logDiff) record() map[string]interface{} {
+	actionRecord := func(action *loggedAction) map[string]interface{} {
+		digests := make([]string, len(action.digests))
+		for i, digest := range action.digests {
+			digests[i] = digest.String()
+		}
+
+		return map[string]interface{}{
+			"target_id":       action.targetID,
+			"action_mnemonic": action.mnemonic,
+			"action_id":       action.actionID,
+			"action_digests":  digests,
+			"cache_hit":       action.cacheHit,
+		}
+	}
+
+	pairRecords := func(pairs []actionPair) []interface{} {
+		records := make([]interface{}, len(pairs))
+		for i, pair := range pairs {
+			records[i] = map[string]interface{}{
+				"a": actionRecord(pair.a),
+				"b": actionRecord(pair.b),
+			}
+		}
+
+		return records
+	}
+
+	actionRecords := func(actions []*loggedAction) []interface{} {
+		records := make([]interface{}, len(actions))
+		for i, action := range actions {
+			records[i] = actionRecord(action)
+		}
+
+		return records
+	}
+
+	uploadRecords := func(uploads []uploadedBlob) []interface{} {
+		records := make([]interface{}, len(uploads))
+		for i, upload := range uploads {
+			records[i] = map[string]interface{}{
+				"digest":          upload.digest.String(),
+				"target_id":       upload.action.targetID,
+				"action_mnemonic": upload.action.mnemonic,
+				"action_id":       upload.action.actionID,
+			}
+		}
+
+		return records
+	}
+
+	return map[string]interface{}{
+		"log_a":              d.runA.path,
+		"log_b":              d.runB.path,
+		"changed_digests":    pairRecords(d.changedDigests),
+		"hit_only_in_a":      pairRecords(d.hitOnlyInA),
+		"hit_only_in_b":      pairRecords(d.hitOnlyInB),
+		"actions_only_in_a":  actionRecords(d.onlyInA),
+		"actions_only_in_b":  actionRecords(d.onlyInB),
+		"uploaded_only_in_a": uploadRecords(d.uploadsOnlyInA),
+		"uploaded_only_in_b": uploadRecords(d.uploadsOnlyInB),
+	}
+}
@@ -0,0 +1,280 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"github.com/leboncoin/bazel-remote-cache-client/pkg/bzlremotelogging"
+)
+
+const chromeTraceFormat = "chrome-trace"
+
+func newLogExportCmd(app *application) *cobra.Command {
+	var (
+		format         string
+		outputFilePath string
+		recoverFlag    bool
+		filter         logFilter
+	)
+
+	cmd := cobra.Command{
+		Use:   "export [flags] <filepath|->...",
+		Short: "Convert gRPC log files to another format",
+		Args:  cobra.MinimumNArgs(1),
+		PreRunE: func(cmd *cobra.Command, args []string) error {
+			if format != chromeTraceFormat {
+				return fmt.Errorf("unsupported export format %q, expected %s", format, chromeTraceFormat)
+			}
+
+			return filter.compile()
+		},
+		RunE: func(cmd *cobra.Command, args []string) error {
+			opts := logReadOptions{
+				filter:  &filter,
+				recover: recoverFlag,
+			}
+
+			traces := make([][]*loggedCall, len(args))
+			for i, logFilePath := range args {
+				err := readLogFile(cmd.Context(), logFilePath, opts, func(le *bzlremotelogging.LogEntry) error {
+					traces[i] = append(traces[i], newLoggedCall(le))
+					return nil
+				})
+				if err != nil {
+					return err
+				}
+			}
+
+			var (
+				w          io.Writer = os.Stdout
+				outputFile *os.File
+			)
+
+			if outputFilePath != "" {
+				var err error
+				if outputFile, err = os.Create(outputFilePath); err != nil {
+					return fmt.Errorf("can't create the output file: %v", err)
+				}
+
+				// Closes the file on errors, it is closed below otherwise.
+				defer func() {
+					_ = outputFile.Close()
+				}()
+
+				w = outputFile
+			}
+
+			bw := bufio.NewWriter(w)
+			if err := writeChromeTrace(bw, args, traces); err != nil {
+				return err
+			}
+
+			if err := bw.Flush(); err != nil {
+				return err
+			}
+
+			if outputFile != nil {
+				if err := outputFile.Close(); err != nil {
+					return fmt.Errorf("can't close the output file: %v", err)
+				}
+			}
+
+			return nil
+		},
+		Example: `  To visualize the cache traffic in chrome://tracing or https://ui.perfetto.dev:
+	$ bazel-remote-cache-client log export --format chrome-trace \
+	    --output-file /tmp/grpc.trace.json /tmp/grpc.log`,
+	}
+
+	fl := cmd.Flags()
+	fl.StringVar(
+		&format, "format", chromeTraceFormat,
+		"Export format (chrome-trace)",
+	)
+	fl.StringVarP(
+		&outputFilePath, "output-file", "o", "",
+		"Output file path, the standard output by default",
+	)
+	fl.BoolVar(
+		&recoverFlag, "recover", false,
+		"Skip the corrupt or truncated entries instead of failing",
+	)
+	filter.addFlags(&cmd)
+
+	return &cmd
+}
+
+// traceEvent is an event of the Chrome Trace Event format:
+// https://docs.google.com/document/d/1CvAClvFfyA5R-PhYUmn5OOQtYMH4h6I0nSsKchNAySU
+type traceEvent struct {
+	Name string `json:"name"`
+	Cat  string `json:"cat,omitempty"`
+	Ph   string `json:"ph"`
+	// Ts is the start time in microseconds.
+	Ts int64 `json:"ts"`
+	// Dur is the duration in microseconds of a complete event.
+	Dur  int64                  `json:"dur,omitempty"`
+	Pid  int                    `json:"pid"`
+	Tid  int                    `json:"tid"`
+	Args map[string]interface{} `json:"args,omitempty"`
+}
+
+// writeChromeTrace writes the calls of log files in the Chrome Trace Event
+// format. Each log file is a process, whose calls are spread over lanes
+// (threads) so that concurrent calls don't overlap.
+func writeChromeTrace(w io.Writer, logFilePaths []string, traces [][]*loggedCall) error {
+	if _, err := io.WriteString(w, "{\"displayTimeUnit\":\"ms\",\"traceEvents\":[\n"); err != nil {
+		return err
+	}
+
+	enc := json.NewEncoder(w)
+
+	var count int
+	writeEvent := func(event *traceEvent) error {
+		if count > 0 {
+			if _, err := io.WriteString(w, ","); err != nil {
+				return err
+			}
+		}
+		count++
+
+		return enc.Encode(event)
+	}
+
+	for i, calls := range traces {
+		pid := i + 1
+
+		err := writeEvent(&traceEvent{
+			Name: "process_name",
+			Ph:   "M",
+			Pid:  pid,
+			Args: map[string]interface{}{"name": logFilePaths[i]},
+		})
+		if err != nil {
+			return err
+		}
+
+		lanes := assignLanes(calls)
+
+		var laneCount int
+		for _, lane := range lanes {
+			if lane >= laneCount {
+				laneCount = lane + 1
+			}
+		}
+
+		for lane := 0; lane < laneCount; lane++ {
+			err := writeEvent(&traceEvent{
+				Name: "thread_name",
+				Ph:   "M",
+				Pid:  pid,
+				Tid:  lane + 1,
+				Args: map[string]interface{}{"name": fmt.Sprintf("lane %d", lane+1)},
+			})
+			if err != nil {
+				return err
+			}
+		}
+
+		for j, call := range calls {
+			if err := writeEvent(callTraceEvent(call, pid, lanes[j]+1)); err != nil {
+				return err
+			}
+		}
+	}
+
+	_, err := io.WriteString(w, "]}\n")
+	return err
+}
+
+// assignLanes returns the lane of each call, the calls of a lane not
+// overlapping: a call goes in the first lane free at its start time.
+func assignLanes(calls []*loggedCall) []int {
+	order := make([]int, len(calls))
+	for i := range order {
+		order[i] = i
+	}
+
+	sort.SliceStable(order, func(i, j int) bool {
+		return calls[order[i]].startTime.Before(calls[order[j]].startTime)
+	})
+
+	lanes := make([]int, len(calls))
+
+	// laneEnds contains the end time of the last call of each lane.
+	var laneEnds []int64
+	for _, i := range order {
+		start := calls[i].startTime.UnixMicro()
+
+		lane := -1
+		for l, end := range laneEnds {
+			if end <= start {
+				lane = l
+				break
+			}
+		}
+
+		if lane < 0 {
+			lane = len(laneEnds)
+			laneEnds = append(laneEnds, 0)
+		}
+
+		laneEnds[lane] = start + traceEventDuration(calls[i])
+		lanes[i] = lane
+	}
+
+	return lanes
+}
+
+// callTraceEvent returns the complete event of a call.
+func callTraceEvent(call *loggedCall, pid, tid int) *traceEvent {
+	service, method, _ := strings.Cut(call.method, "/")
+
+	args := map[string]interface{}{
+		"method": call.method,
+		"status": call.code.String(),
+	}
+	if call.targetID != "" {
+		args["target"] = call.targetID
+	}
+	if call.mnemonic != "" {
+		args["mnemonic"] = call.mnemonic
+	}
+	if call.actionID != "" {
+		args["action_id"] = call.actionID
+	}
+	if call.resource != "" {
+		args["resource"] = call.resource
+	}
+	if call.bytes > 0 {
+		args["bytes"] = call.bytes
+	}
+
+	return &traceEvent{
+		Name: method,
+		Cat:  service,
+		Ph:   "X",
+		Ts:   call.startTime.UnixMicro(),
+		Dur:  traceEventDuration(call),
+		Pid:  pid,
+		Tid:  tid,
+		Args: args,
+	}
+}
+
+// traceEventDuration returns the duration of a call in microseconds,
+// at least 1 as zero-length events aren't displayed.
+func traceEventDuration(call *loggedCall) int64 {
+	if dur := call.duration.Microseconds(); dur > 0 {
+		return dur
+	}
+
+	return 1
+}
@@ -0,0 +1,321 @@
+package main
+
+import (
+	"sort"
+	"time"
+
+	"github.com/spf13/cobra"
+	"google.golang.org/grpc/codes"
+
+	"github.com/leboncoin/bazel-remote-cache-client/pkg/bzlremotecache"
+	"github.com/leboncoin/bazel-remote-cache-client/pkg/bzlremotelogging"
+)
+
+func newLogStatsCmd(app *application) *cobra.Command {
+	var (
+		top         int
+		recoverFlag bool
+		filter      logFilter
+	)
+
+	cmd := cobra.Command{
+		Use:   "stats [flags] <filepath>...",
+		Short: "Summarize the calls of gRPC log files",
+		Args:  cobra.MinimumNArgs(1),
+		PreRunE: func(cmd *cobra.Command, args []string) error {
+			return filter.compile()
+		},
+		RunE: func(cmd *cobra.Command, args []string) error {
+			stats := newLogStats(top)
+			opts := logReadOptions{
+				filter:  &filter,
+				recover: recoverFlag,
+			}
+			for _, logFilePath := range args {
+				if err := readLogFile(cmd.Context(), logFilePath, opts, stats.add); err != nil {
+					return err
+				}
+			}
+
+			if app.OutputFormat.IsStructured() {
+				records := newRecordWriter(app.OutputFormat)
+				if err := records.Write(stats.record()); err != nil {
+					return err
+				}
+
+				return records.Close()
+			}
+
+			printLogStats(stats)
+
+			return nil
+		},
+		Example: `  To know the cache hit ratio of a build and its slowest calls:
+	$ bazel-remote-cache-client log stats /tmp/grpc.log`,
+	}
+
+	fl := cmd.Flags()
+	fl.IntVarP(
+		&top, "top", "n", 10,
+		"Number of slowest calls and largest transfers to show",
+	)
+	fl.BoolVar(
+		&recoverFlag, "recover", false,
+		"Skip the corrupt or truncated entries instead of failing",
+	)
+	filter.addFlags(&cmd)
+
+	return &cmd
+}
+
+// loggedCall is the summary of a log entry.
+type loggedCall struct {
+	method    string
+	startTime time.Time
+	duration  time.Duration
+	code      codes.Code
+	bytes     int64
+	resource  string
+	targetID  string
+	mnemonic  string
+	actionID  string
+}
+
+func newLoggedCall(le *bzlremotelogging.LogEntry) *loggedCall {
+	call := loggedCall{
+		method:    le.GetMethodName(),
+		startTime: le.GetStartTime().AsTime(),
+		duration:  le.GetEndTime().AsTime().Sub(le.GetStartTime().AsTime()),
+		code:      codes.Code(le.GetStatus().GetCode()),
+		bytes:     logEntryBytes(le),
+		targetID:  le.GetMetadata().GetTargetId(),
+		mnemonic:  le.GetMetadata().GetActionMnemonic(),
+		actionID:  le.GetMetadata().GetActionId(),
+	}
+
+	switch details := le.GetDetails().GetDetails().(type) {
+	case *bzlremotelogging.RpcCallDetails_GetActionResult:
+		if d := details.GetActionResult.GetRequest().GetActionDigest(); d != nil {
+			call.resource = bzlremotecache.DigestFromProto(d).String()
+		}
+	case *bzlremotelogging.RpcCallDetails_Read:
+		call.resource = details.Read.GetRequest().GetResourceName()
+	case *bzlremotelogging.RpcCallDetails_Write:
+		if resourceNames := details.Write.GetResourceNames(); len(resourceNames) > 0 {
+			call.resource = resourceNames[0]
+		}
+	}
+
+	return &call
+}
+
+// methodStats contains the statistics of the calls of a gRPC method.
+type methodStats struct {
+	method    string
+	codes     map[codes.Code]int
+	durations []time.Duration
+}
+
+// percentile returns the p-th percentile of the call durations,
+// which must be sorted.
+func (s *methodStats) percentile(p float64) time.Duration {
+	if len(s.durations) == 0 {
+		return 0
+	}
+
+	i := int(p/100*float64(len(s.durations))+0.5) - 1
+	if i < 0 {
+		i = 0
+	} else if i >= len(s.durations) {
+		i = len(s.durations) - 1
+	}
+
+	return s.durations[i]
+}
+
+// topCalls keeps the n greatest calls according to a key.
+type topCalls struct {
+	n     int
+	key   func(*loggedCall) int64
+	calls []*loggedCall
+}
+
+func (t *topCalls) add(call *loggedCall) {
+	if t.n <= 0 {
+		return
+	}
+
+	k := t.key(call)
+	if len(t.calls) == t.n && k <= t.key(t.calls[len(t.calls)-1]) {
+		return
+	}
+
+	i := sort.Search(len(t.calls), func(i int) bool {
+		return t.key(t.calls[i]) < k
+	})
+
+	if len(t.calls) < t.n {
+		t.calls = append(t.calls, nil)
+	}
+	copy(t.calls[i+1:], t.calls[i:])
+	t.calls[i] = call
+}
+
+// logStats contains the statistics of log entries.
+type logStats struct {
+	entries   int
+	firstTime time.Time
+	lastTime  time.Time
+
+	methods      map[string]*methodStats
+	acHits       int
+	acMisses     int
+	bytesRead    int64
+	bytesWritten int64
+
+	slowest topCalls
+	largest topCalls
+}
+
+func newLogStats(top int) *logStats {
+	return &logStats{
+		methods: make(map[string]*methodStats),
+		slowest: topCalls{
+			n:   top,
+			key: func(c *loggedCall) int64 { return int64(c.duration) },
+		},
+		largest: topCalls{
+			n:   top,
+			key: func(c *loggedCall) int64 { return c.bytes },
+		},
+	}
+}
+
+func (s *logStats) add(le *bzlremotelogging.LogEntry) error {
+	call := newLoggedCall(le)
+
+	switch le.GetDetails().GetDetails().(type) {
+	case *bzlremotelogging.RpcCallDetails_GetActionResult:
+		switch call.code {
+		case codes.OK:
+			s.acHits++
+		case codes.NotFound:
+			s.acMisses++
+		}
+	case *bzlremotelogging.RpcCallDetails_Read:
+		s.bytesRead += call.bytes
+	case *bzlremotelogging.RpcCallDetails_Write:
+		s.bytesWritten += call.bytes
+	}
+
+	s.entries++
+	if s.firstTime.IsZero() || call.startTime.Before(s.firstTime) {
+		s.firstTime = call.startTime
+	}
+	if endTime := call.startTime.Add(call.duration); endTime.After(s.lastTime) {
+		s.lastTime = endTime
+	}
+
+	ms, ok := s.methods[call.method]
+	if !ok {
+		ms = &methodStats{
+			method: call.method,
+			codes:  make(map[codes.Code]int),
+		}
+		s.methods[call.method] = ms
+	}
+	ms.codes[call.code]++
+	ms.durations = append(ms.durations, call.duration)
+
+	s.slowest.add(call)
+	if call.bytes > 0 {
+		s.largest.add(call)
+	}
+
+	return nil
+}
+
+// sortedMethods returns the statistics of the methods sorted by name,
+// with their durations sorted.
+func (s *logStats) sortedMethods() []*methodStats {
+	methods := make([]*methodStats, 0, len(s.methods))
+	for _, ms := range s.methods {
+		sort.Slice(ms.durations, func(i, j int) bool {
+			return ms.durations[i] < ms.durations[j]
+		})
+		methods = append(methods, ms)
+	}
+
+	sort.Slice(methods, func(i, j int) bool {
+		return methods[i].method < methods[j].method
+	})
+
+	return methods
+}
+
+// acHitRatio returns the ratio of the GetActionResult calls which hit the cache.
+func (s *logStats) acHitRatio() float64 {
+	if s.acHits+s.acMisses == 0 {
+		return 0
+	}
+
+	return float64(s.acHits) / float64(s.acHits+s.acMisses)
+}
+
+// record returns the record of the statistics printed with a structured output.
+func (s *logStats) record() map[string]interface{} {
+	callRecords := func(calls []*loggedCall) []interface{} {
+		records := make([]interface{}, len(calls))
+		for i, call := range calls {
+			records[i] = map[string]interface{}{
+				"method_name":     call.method,
+				"start_time":      call.startTime.Format(time.RFC3339Nano),
+				"duration":        call.duration.String(),
+				"status":          call.code.String(),
+				"bytes":           call.bytes,
+				"resource":        call.resource,
+				"target_id":       call.targetID,
+				"action_mnemonic": call.mnemonic,
+			}
+		}
+
+		return records
+	}
+
+	methods := make([]interface{}, 0, len(s.methods))
+	for _, ms := range s.sortedMethods() {
+		statuses := make(map[string]int, len(ms.codes))
+		for code, count := range ms.codes {
+			statuses[code.String()] = count
+		}
+
+		methods = append(methods, map[string]interface{}{
+			"method_name": ms.method,
+			"calls":       len(ms.durations),
+			"statuses":    statuses,
+			"p50":         ms.percentile(50).String(),
+			"p90":         ms.percentile(90).String(),
+			"p99":         ms.percentile(99).String(),
+			"max":         ms.percentile(100).String(),
+		})
+	}
+
+	record := map[string]interface{}{
+		"entries":           s.entries,
+		"methods":           methods,
+		"ac_hits":           s.acHits,
+		"ac_misses":         s.acMisses,
+		"ac_hit_ratio":      s.acHitRatio(),
+		"bytes_read":        s.bytesRead,
+		"bytes_written":     s.bytesWritten,
+		"slowest_calls":     callRecords(s.slowest.calls),
+		"largest_transfers": callRecords(s.largest.calls),
+	}
+
+	if s.entries > 0 {
+		record["start_time"] = s.firstTime.Format(time.RFC3339Nano)
+		record["end_time"] = s.lastTime.Format(time.RFC3339Nano)
+	}
+
+	return record
+}
@@ -0,0 +1,236 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	remoteexecution "github.com/bazelbuild/remote-apis/build/bazel/remote/execution/v2"
+	"google.golang.org/protobuf/proto"
+
+	"github.com/leboncoin/bazel-remote-cache-client/pkg/bzlremotecache"
+)
+
+// downloadFailure is an output which can't be downloaded.
+type downloadFailure struct {
+	path string
+	err  error
+}
+
+// downloadActionResult materializes the outputs of an action result in the
+// output directory, laid out like the Bazel execution root. The stdout and
+// stderr of the action are written in <action hash>.stdout and
+// <action hash>.stderr. It returns the outputs which can't be downloaded.
+func downloadActionResult(
+	ctx context.Context, app *application,
+	actionDigest *bzlremotecache.Digest, ar *remoteexecution.ActionResult,
+	outputDirPath string, jobs int,
+) []downloadFailure {
+	var (
+		targets  []blobTarget
+		symlinks []*remoteexecution.OutputSymlink
+		failures []downloadFailure
+	)
+
+	addFailure := func(path string, err error) {
+		failures = append(failures, downloadFailure{path: path, err: err})
+	}
+
+	for _, of := range ar.OutputFiles {
+		filePath, err := outputPath(outputDirPath, of.Path)
+		if err != nil {
+			addFailure(of.Path, err)
+			continue
+		}
+
+		targets = append(targets, blobTarget{
+			digest:       bzlremotecache.DigestFromProto(of.Digest),
+			path:         filePath,
+			isExecutable: of.IsExecutable,
+		})
+	}
+
+	for _, od := range ar.OutputDirectories {
+		treeTargets, treeSymlinks, err := outputDirectoryContent(ctx, app, od, outputDirPath)
+		if err != nil {
+			addFailure(od.Path, err)
+			continue
+		}
+
+		targets = append(targets, treeTargets...)
+		symlinks = append(symlinks, treeSymlinks...)
+	}
+
+	symlinks = append(symlinks, ar.OutputFileSymlinks...)
+	symlinks = append(symlinks, ar.OutputDirectorySymlinks...)
+	symlinks = append(symlinks, ar.OutputSymlinks...)
+
+	for i, std := range []struct {
+		raw    []byte
+		digest *remoteexecution.Digest
+	}{
+		{ar.StdoutRaw, ar.StdoutDigest},
+		{ar.StderrRaw, ar.StderrDigest},
+	} {
+		stdPath := filepath.Join(outputDirPath, actionDigest.Hash+[]string{".stdout", ".stderr"}[i])
+
+		if len(std.raw) > 0 {
+			if err := os.WriteFile(stdPath, std.raw, 0644); err != nil {
+				addFailure(stdPath, err)
+			}
+		} else if std.digest.GetSizeBytes() > 0 {
+			targets = append(targets, blobTarget{
+				digest: bzlremotecache.DigestFromProto(std.digest),
+				path:   stdPath,
+			})
+		}
+	}
+
+	for i, err := range downloadBlobs(ctx, app, targets, jobs) {
+		if err != nil {
+			addFailure(targets[i].path, err)
+		}
+	}
+
+	// The paths are checked again as the symlinks are created, as a symlink
+	// created before could be the parent directory of the next ones.
+	for _, symlink := range symlinks {
+		symlinkPath, err := outputPath(outputDirPath, symlink.Path)
+		if err != nil {
+			addFailure(symlink.Path, err)
+		} else if err := createSymlink(symlink.Target, symlinkPath); err != nil {
+			addFailure(symlinkPath, err)
+		}
+	}
+
+	return failures
+}
+
+func printDownloadFailures(prefix string, app *application, failures []downloadFailure) {
+	fmt.Printf(prefix+"%s:\n", cf("DownloadErrors"))
+	for _, failure := range failures {
+		fmt.Printf(
+			prefix+"  - %s: %s\n",
+			cyanColor.Sprint(failure.path),
+			errorColor.Sprint(app.BazelRemoteCache.ErrorMsg(failure.err)),
+		)
+	}
+}
+
+// outputDirectoryContent returns the files and the symlinks of an output
+// directory, creating its directories in the output directory.
+func outputDirectoryContent(
+	ctx context.Context, app *application, od *remoteexecution.OutputDirectory,
+	outputDirPath string,
+) ([]blobTarget, []*remoteexecution.OutputSymlink, error) {
+	tree, err := app.BazelRemoteCache.GetTree(ctx, bzlremotecache.DigestFromProto(od.TreeDigest))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	getDir, err := bzlremotecache.TreeDirectoryGetter(tree)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	rootPath, err := outputPath(outputDirPath, od.Path)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if err := os.MkdirAll(rootPath, 0755); err != nil {
+		return nil, nil, err
+	}
+
+	var (
+		targets  []blobTarget
+		symlinks []*remoteexecution.OutputSymlink
+	)
+
+	err = bzlremotecache.WalkDirectory(ctx, tree.Root, getDir, func(nodePath string, node proto.Message) error {
+		// The node names come from the cache, so they are checked
+		// like the output paths.
+		path, err := outputPath(rootPath, nodePath)
+		if err != nil {
+			return err
+		}
+
+		switch n := node.(type) {
+		case *remoteexecution.FileNode:
+			targets = append(targets, blobTarget{
+				digest:       bzlremotecache.DigestFromProto(n.Digest),
+				path:         path,
+				isExecutable: n.IsExecutable,
+			})
+		case *remoteexecution.SymlinkNode:
+			symlinks = append(symlinks, &remoteexecution.OutputSymlink{
+				Path:   filepath.ToSlash(filepath.Join(od.Path, nodePath)),
+				Target: n.Target,
+			})
+		case *remoteexecution.DirectoryNode:
+			return os.MkdirAll(path, 0755)
+		}
+
+		return nil
+	})
+
+	return targets, symlinks, err
+}
+
+// outputPath returns the path of an output in the output directory. The
+// output paths come from the cache, so the absolute paths and the paths
+// escaping the output directory, including through a symlink, are rejected.
+func outputPath(outputDirPath, path string) (string, error) {
+	if path == "" || filepath.IsAbs(path) || strings.HasPrefix(path, "/") {
+		return "", fmt.Errorf("invalid output path %q, expected a relative path", path)
+	}
+
+	for _, part := range strings.Split(filepath.ToSlash(path), "/") {
+		if part == ".." {
+			return "", fmt.Errorf("invalid output path %q, escaping the output directory", path)
+		}
+	}
+
+	joined := filepath.Join(outputDirPath, path)
+
+	rel, err := filepath.Rel(filepath.Clean(outputDirPath), joined)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("invalid output path %q, escaping the output directory", path)
+	}
+
+	// A symlink in the output directory could point outside of it.
+	parts := strings.Split(rel, string(filepath.Separator))
+	dirPath := filepath.Clean(outputDirPath)
+	for _, part := range parts[:len(parts)-1] {
+		dirPath = filepath.Join(dirPath, part)
+
+		fi, err := os.Lstat(dirPath)
+		if errors.Is(err, os.ErrNotExist) {
+			break
+		} else if err != nil {
+			return "", err
+		}
+
+		if fi.Mode()&os.ModeSymlink != 0 {
+			return "", fmt.Errorf("invalid output path %q, going through the symlink %s", path, dirPath)
+		}
+	}
+
+	return joined, nil
+}
+
+// createSymlink creates a symlink, replacing the existing one.
+func createSymlink(target, symlinkPath string) error {
+	if err := os.MkdirAll(filepath.Dir(symlinkPath), 0755); err != nil {
+		return err
+	}
+
+	if err := os.Remove(symlinkPath); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+
+	return os.Symlink(target, symlinkPath)
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	remoteexecution "github.com/bazelbuild/remote-apis/build/bazel/remote/execution/v2"
+
+	"github.com/leboncoin/bazel-remote-cache-client/pkg/bzlremotecache"
+)
+
+func TestDownloadActionResultSymlinkEscape(t *testing.T) {
+	content := []byte("content")
+
+	app, backend := newTestApp(t, content)
+	ctx := context.Background()
+
+	outsideDir := t.TempDir()
+	outputDir := t.TempDir()
+
+	actionDigest := mustDigest(t, []byte("action"))
+
+	// A tree with a symlink to the outside directory, followed by a
+	// symlink in the directory it points to.
+	tree := &remoteexecution.Tree{
+		Root: &remoteexecution.Directory{
+			Symlinks: []*remoteexecution.SymlinkNode{{Name: "link", Target: outsideDir}},
+		},
+	}
+
+	treeBlob, err := bzlremotecache.NewProtoBlob(tree)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := app.BazelRemoteCache.UploadBlobs(ctx, []*bzlremotecache.Blob{treeBlob}, 1); err != nil {
+		t.Fatal(err)
+	}
+
+	ar := &remoteexecution.ActionResult{
+		OutputDirectories: []*remoteexecution.OutputDirectory{{
+			Path:       "dir",
+			TreeDigest: treeBlob.Digest.ToProto(),
+		}},
+		OutputSymlinks: []*remoteexecution.OutputSymlink{
+			{Path: "a", Target: outsideDir},
+			{Path: "a/b", Target: "/etc/passwd"},
+			{Path: "dir/link/c", Target: "/etc/passwd"},
+		},
+	}
+
+	if _, err := backend.UpdateActionResult(ctx, actionDigest, ar); err != nil {
+		t.Fatal(err)
+	}
+
+	failures := downloadActionResult(ctx, app, actionDigest, ar, outputDir, 1)
+	if len(failures) != 2 {
+		t.Errorf("expected 2 failures, got %v", failures)
+	}
+
+	entries, err := os.ReadDir(outsideDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(entries) != 0 {
+		t.Errorf("expected nothing written outside of the output directory, got %v", entries)
+	}
+
+	// A later download can't write through the created symlinks either.
+	ar = &remoteexecution.ActionResult{
+		OutputFiles: []*remoteexecution.OutputFile{{
+			Path:   "a/file",
+			Digest: mustDigest(t, content).ToProto(),
+		}},
+	}
+
+	if failures := downloadActionResult(ctx, app, actionDigest, ar, outputDir, 1); len(failures) != 1 {
+		t.Errorf("expected 1 failure, got %v", failures)
+	}
+
+	if _, err := os.Lstat(filepath.Join(outsideDir, "file")); !os.IsNotExist(err) {
+		t.Errorf("expected no file written outside of the output directory, got %v", err)
+	}
+}
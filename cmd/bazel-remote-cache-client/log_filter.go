@@ -0,0 +1,229 @@
+package main
+
+import (
+	"fmt"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+	"google.golang.org/grpc/codes"
+
+	"github.com/leboncoin/bazel-remote-cache-client/pkg/bzlremotelogging"
+)
+
+// logFilter selects the log entries to process. Within a criterion, an entry
+// matches if any of the values matches; an entry must match all the criteria.
+type logFilter struct {
+	methods     []string
+	statuses    []string
+	targets     []string
+	mnemonics   []string
+	actionIDs   []string
+	since       string
+	until       string
+	minDuration time.Duration
+	minBytes    int64
+
+	codes     map[codes.Code]bool
+	sinceTime time.Time
+	untilTime time.Time
+}
+
+// addFlags adds the flags of the filter to a command.
+func (f *logFilter) addFlags(cmd *cobra.Command) {
+	fl := cmd.Flags()
+	fl.StringArrayVar(
+		&f.methods, "method", nil,
+		"Only show the calls of a gRPC method, e.g. GetActionResult or ByteStream/Read (can be repeated)",
+	)
+	fl.StringArrayVar(
+		&f.statuses, "status", nil,
+		"Only show the calls which returned a gRPC status code, e.g. NOT_FOUND or 5 (can be repeated)",
+	)
+	fl.StringArrayVar(
+		&f.targets, "target", nil,
+		"Only show the calls of targets matching a label pattern, e.g. //foo/..., //foo:all or //foo:*_test (can be repeated)",
+	)
+	fl.StringArrayVar(
+		&f.mnemonics, "mnemonic", nil,
+		"Only show the calls of actions with a mnemonic (can be repeated)",
+	)
+	fl.StringArrayVar(
+		&f.actionIDs, "action-id", nil,
+		"Only show the calls of an action ID (can be repeated)",
+	)
+	fl.StringVar(
+		&f.since, "since", "",
+		"Only show the calls started at or after a time (RFC 3339)",
+	)
+	fl.StringVar(
+		&f.until, "until", "",
+		"Only show the calls started before a time (RFC 3339)",
+	)
+	fl.DurationVar(
+		&f.minDuration, "min-duration", 0,
+		"Only show the calls lasting at least a duration, e.g. 500ms",
+	)
+	fl.Int64Var(
+		&f.minBytes, "min-bytes", 0,
+		"Only show the calls transferring at least a number of bytes",
+	)
+}
+
+// compile parses the values of the flags.
+func (f *logFilter) compile() error {
+	if len(f.statuses) > 0 {
+		f.codes = make(map[codes.Code]bool, len(f.statuses))
+		for _, s := range f.statuses {
+			code, err := parseGRPCCode(s)
+			if err != nil {
+				return err
+			}
+
+			f.codes[code] = true
+		}
+	}
+
+	for _, target := range f.targets {
+		if _, err := path.Match(target, ""); err != nil {
+			return fmt.Errorf("invalid target pattern %q: %v", target, err)
+		}
+	}
+
+	var err error
+	if f.since != "" {
+		if f.sinceTime, err = time.Parse(time.RFC3339, f.since); err != nil {
+			return fmt.Errorf("invalid --since time: %v", err)
+		}
+	}
+
+	if f.until != "" {
+		if f.untilTime, err = time.Parse(time.RFC3339, f.until); err != nil {
+			return fmt.Errorf("invalid --until time: %v", err)
+		}
+	}
+
+	return nil
+}
+
+// parseGRPCCode parses a gRPC status code from its name or its number.
+func parseGRPCCode(s string) (codes.Code, error) {
+	var code codes.Code
+	if err := code.UnmarshalJSON([]byte(strconv.Quote(strings.ToUpper(s)))); err != nil {
+		if n, err := strconv.ParseUint(s, 10, 32); err == nil {
+			return codes.Code(n), nil
+		}
+
+		return 0, fmt.Errorf("invalid gRPC status code %q", s)
+	}
+
+	return code, nil
+}
+
+// match reports whether a log entry matches the filter.
+func (f *logFilter) match(le *bzlremotelogging.LogEntry) bool {
+	if f == nil {
+		return true
+	}
+
+	if len(f.methods) > 0 && !matchAny(f.methods, func(method string) bool {
+		return strings.HasSuffix(le.GetMethodName(), method)
+	}) {
+		return false
+	}
+
+	if f.codes != nil && !f.codes[codes.Code(le.GetStatus().GetCode())] {
+		return false
+	}
+
+	md := le.GetMetadata()
+
+	if len(f.targets) > 0 && !matchAny(f.targets, func(pattern string) bool {
+		return matchTargetPattern(pattern, md.GetTargetId())
+	}) {
+		return false
+	}
+
+	if len(f.mnemonics) > 0 && !matchAny(f.mnemonics, func(mnemonic string) bool {
+		return md.GetActionMnemonic() == mnemonic
+	}) {
+		return false
+	}
+
+	if len(f.actionIDs) > 0 && !matchAny(f.actionIDs, func(actionID string) bool {
+		return md.GetActionId() == actionID
+	}) {
+		return false
+	}
+
+	startTime := le.GetStartTime().AsTime()
+	if !f.sinceTime.IsZero() && startTime.Before(f.sinceTime) {
+		return false
+	}
+
+	if !f.untilTime.IsZero() && !startTime.Before(f.untilTime) {
+		return false
+	}
+
+	if f.minDuration > 0 && le.GetEndTime().AsTime().Sub(startTime) < f.minDuration {
+		return false
+	}
+
+	if f.minBytes > 0 && logEntryBytes(le) < f.minBytes {
+		return false
+	}
+
+	return true
+}
+
+func matchAny(values []string, matchFunc func(string) bool) bool {
+	for _, v := range values {
+		if matchFunc(v) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// matchTargetPattern reports whether a label matches a target pattern:
+// "//foo/..." matches the targets of a package and its subpackages,
+// "//foo:all" the targets of a package and the other patterns are matched
+// with path.Match.
+func matchTargetPattern(pattern, label string) bool {
+	if label == "" {
+		return false
+	}
+
+	// Labels of the main repository may be prefixed with "@" or "@@".
+	label = strings.TrimLeft(label, "@")
+	pattern = strings.TrimLeft(pattern, "@")
+
+	labelPkg, _, _ := strings.Cut(label, ":")
+
+	if strings.HasSuffix(pattern, "/...") {
+		pkg := strings.TrimSuffix(pattern, "/...")
+		return labelPkg == pkg || strings.HasPrefix(labelPkg, pkg+"/")
+	}
+
+	if strings.HasSuffix(pattern, ":all") {
+		return labelPkg == strings.TrimSuffix(pattern, ":all")
+	}
+
+	matched, _ := path.Match(pattern, label)
+	return matched
+}
+
+// logEntryBytes returns the number of bytes transferred by a call.
+func logEntryBytes(le *bzlremotelogging.LogEntry) int64 {
+	switch details := le.GetDetails().GetDetails().(type) {
+	case *bzlremotelogging.RpcCallDetails_Read:
+		return details.Read.GetBytesRead()
+	case *bzlremotelogging.RpcCallDetails_Write:
+		return details.Write.GetBytesSent()
+	default:
+		return 0
+	}
+}
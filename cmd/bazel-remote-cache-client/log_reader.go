@@ -0,0 +1,273 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/klauspost/compress/zstd"
+	"google.golang.org/protobuf/encoding/protowire"
+	"google.golang.org/protobuf/proto"
+
+	"github.com/leboncoin/bazel-remote-cache-client/pkg/bzlremotelogging"
+)
+
+// maxLogEntrySize bounds the size of a log entry, so that garbage isn't
+// mistaken for the size of a huge entry.
+const maxLogEntrySize = 64 << 20
+
+// Magic bytes of the compressed log files.
+var (
+	gzipMagic = []byte{0x1f, 0x8b}
+	zstdMagic = []byte{0x28, 0xb5, 0x2f, 0xfd}
+)
+
+// newDecompressingReader returns a reader decompressing r if it starts with
+// the magic bytes of gzip or zstd, reading r as is otherwise.
+func newDecompressingReader(r io.Reader) (io.ReadCloser, error) {
+	br := bufio.NewReader(r)
+
+	magic, err := br.Peek(len(zstdMagic))
+	if err != nil && !errors.Is(err, io.EOF) {
+		return nil, err
+	}
+
+	switch {
+	case bytes.HasPrefix(magic, gzipMagic):
+		return gzip.NewReader(br)
+	case bytes.HasPrefix(magic, zstdMagic):
+		zr, err := zstd.NewReader(br)
+		if err != nil {
+			return nil, err
+		}
+
+		return zr.IOReadCloser(), nil
+	default:
+		return io.NopCloser(br), nil
+	}
+}
+
+// errTruncatedEntry is returned for an entry cut by the end of the stream.
+var errTruncatedEntry = errors.New("truncated entry")
+
+// logReader decodes the varint-delimited entries of a log stream. It buffers
+// the bytes of the current entry, so that it can resynchronize on the next
+// decodable entry after a corruption.
+type logReader struct {
+	r   io.Reader
+	buf []byte
+	// start is the beginning of the unread bytes in buf.
+	start int
+	// offset is the offset in the stream of the unread bytes.
+	offset int64
+	eof    bool
+	// err is the error returned by r, other than io.EOF.
+	err error
+}
+
+func newLogReader(r io.Reader) *logReader {
+	return &logReader{
+		r:   r,
+		buf: make([]byte, 0, 64*1024),
+	}
+}
+
+// buffered returns the number of unread bytes in the buffer.
+func (lr *logReader) buffered() int {
+	return len(lr.buf) - lr.start
+}
+
+// fill reads until at least n unread bytes are buffered, or the end of
+// the stream.
+func (lr *logReader) fill(n int) {
+	for lr.buffered() < n && !lr.eof && lr.err == nil {
+		if lr.start > 0 {
+			lr.buf = lr.buf[:copy(lr.buf, lr.buf[lr.start:])]
+			lr.start = 0
+		}
+
+		if cap(lr.buf) < n {
+			buf := make([]byte, len(lr.buf), n)
+			copy(buf, lr.buf)
+			lr.buf = buf
+		}
+
+		m, err := lr.r.Read(lr.buf[len(lr.buf):cap(lr.buf)])
+		lr.buf = lr.buf[:len(lr.buf)+m]
+
+		if errors.Is(err, io.EOF) {
+			lr.eof = true
+		} else if err != nil {
+			lr.err = err
+		}
+	}
+}
+
+// next decodes the entry at the current offset, without consuming it, and
+// returns the size of its record. It returns io.EOF at the end of the stream.
+func (lr *logReader) next(le *bzlremotelogging.LogEntry) (int, error) {
+	n, size, err := lr.entrySize()
+	if err != nil {
+		return 0, err
+	}
+
+	recordSize := n + size
+
+	lr.fill(recordSize)
+	if lr.err != nil {
+		return 0, lr.err
+	}
+
+	if lr.buffered() < recordSize {
+		// The stream ends in the middle of the entry, unless its size is
+		// corrupt and other entries follow. The rest of the stream is
+		// buffered, so it is searched for an entry without consuming it.
+		start, offset := lr.start, lr.offset
+		_, err := lr.resync(&bzlremotelogging.LogEntry{})
+		lr.start, lr.offset = start, offset
+
+		if err == nil {
+			return 0, fmt.Errorf("entry size %d exceeds the end of the stream", size)
+		}
+
+		return 0, errTruncatedEntry
+	}
+
+	if err := proto.Unmarshal(lr.buf[lr.start+n:lr.start+recordSize], le); err != nil {
+		return 0, err
+	}
+
+	return recordSize, nil
+}
+
+// entrySize decodes the size of the entry at the current offset, and returns
+// the length of the size followed by the size.
+func (lr *logReader) entrySize() (int, int, error) {
+	var (
+		size uint64
+		n    int
+	)
+
+	// The size is read byte by byte to not wait for bytes past the end of
+	// the record when following a growing file.
+	for i := 1; i <= binary.MaxVarintLen64; i++ {
+		lr.fill(i)
+		if lr.err != nil {
+			return 0, 0, lr.err
+		}
+
+		if lr.buffered() == 0 {
+			return 0, 0, io.EOF
+		}
+
+		if size, n = binary.Uvarint(lr.buf[lr.start:]); n != 0 || lr.buffered() < i {
+			break
+		}
+	}
+
+	switch {
+	case n == 0:
+		return 0, 0, errTruncatedEntry
+	case n < 0:
+		return 0, 0, errors.New("invalid entry size")
+	case size > maxLogEntrySize:
+		return 0, 0, fmt.Errorf("entry size %d exceeds %d bytes", size, maxLogEntrySize)
+	}
+
+	return n, int(size), nil
+}
+
+// skip consumes n bytes.
+func (lr *logReader) skip(n int) {
+	lr.start += n
+	lr.offset += int64(n)
+}
+
+// corruptRegion is a range of bytes of a log stream skipped to resynchronize
+// on the next decodable entry.
+type corruptRegion struct {
+	// offset is the byte offset of the region.
+	offset int64
+	// index is the index of the entry expected at the offset.
+	index int
+	size  int64
+	err   error
+}
+
+// resync skips bytes until the next decodable entry, or the end of the stream.
+// An entry is decodable if it has at least a method name and a start time, to
+// not mistake garbage for an entry. The entries are only decoded once their
+// field headers look like the ones of an entry, as decoding a garbage size of
+// up to maxLogEntrySize bytes at every offset would be quadratic.
+func (lr *logReader) resync(le *bzlremotelogging.LogEntry) (int, error) {
+	for {
+		lr.skip(1)
+
+		n, size, err := lr.entrySize()
+		if errors.Is(err, io.EOF) || lr.err != nil {
+			return 0, err
+		}
+
+		if err != nil || !lr.hasEntryFields(n, size) {
+			continue
+		}
+
+		lr.fill(n + size)
+		if lr.buffered() < n+size {
+			continue
+		}
+
+		proto.Reset(le)
+		err = proto.Unmarshal(lr.buf[lr.start+n:lr.start+n+size], le)
+		if err == nil && le.MethodName != "" && le.StartTime != nil {
+			return n + size, nil
+		}
+	}
+}
+
+// hasEntryFields returns whether the record at the current offset, whose size
+// of n bytes is followed by size bytes, only has the fields of a LogEntry,
+// including its start time and its method name. Only the field headers are
+// read, the fields of a LogEntry being all length-delimited.
+func (lr *logReader) hasEntryFields(n, size int) bool {
+	var hasStartTime, hasMethodName bool
+
+	for pos, end := n, n+size; pos < end; {
+		headerEnd := pos + 2*binary.MaxVarintLen64
+		if headerEnd > end {
+			headerEnd = end
+		}
+
+		lr.fill(headerEnd)
+		if lr.buffered() < headerEnd {
+			return false
+		}
+
+		header := lr.buf[lr.start+pos : lr.start+headerEnd]
+
+		num, typ, tagLen := protowire.ConsumeTag(header)
+		if tagLen < 0 || typ != protowire.BytesType || num < 1 || num > 6 {
+			return false
+		}
+
+		length, lengthLen := protowire.ConsumeVarint(header[tagLen:])
+		if lengthLen < 0 || length > uint64(end-pos-tagLen-lengthLen) {
+			return false
+		}
+
+		switch num {
+		case 1:
+			hasStartTime = true
+		case 5:
+			hasMethodName = true
+		}
+
+		pos += tagLen + lengthLen + int(length)
+	}
+
+	return hasStartTime && hasMethodName
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	"github.com/leboncoin/bazel-remote-cache-client/pkg/bzlremotelogging"
+)
+
+// newTestLog returns a log stream of the given number of entries.
+func newTestLog(t *testing.T, count int) []byte {
+	t.Helper()
+
+	var buf bytes.Buffer
+	for i := 0; i < count; i++ {
+		le := bzlremotelogging.LogEntry{
+			StartTime:  timestamppb.Now(),
+			MethodName: "/build.bazel.remote.execution.v2.ActionCache/GetActionResult",
+		}
+
+		data, err := proto.Marshal(&le)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		buf.Write(uvarint(uint64(len(data))))
+		buf.Write(data)
+	}
+
+	return buf.Bytes()
+}
+
+func uvarint(x uint64) []byte {
+	buf := make([]byte, binary.MaxVarintLen64)
+	return buf[:binary.PutUvarint(buf, x)]
+}
+
+// readTestLog reads a log stream in recovery mode, and returns
+// the number of entries and the skipped regions.
+func readTestLog(t *testing.T, data []byte) (int, []corruptRegion) {
+	t.Helper()
+
+	var count int
+	regions, err := readStreamProtoLog(
+		bytes.NewReader(data), logReadOptions{recover: true},
+		func(le *bzlremotelogging.LogEntry) error {
+			count++
+			return nil
+		},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return count, regions
+}
+
+func TestReadStreamProtoLogTruncated(t *testing.T) {
+	data := newTestLog(t, 3)
+
+	count, regions := readTestLog(t, data[:len(data)-5])
+	if count != 2 {
+		t.Errorf("expected 2 entries, got %d", count)
+	}
+
+	if len(regions) != 1 || regions[0].err != errTruncatedEntry {
+		t.Errorf("expected a truncated entry, got %v", regions)
+	}
+}
+
+func TestReadStreamProtoLogCorruptSize(t *testing.T) {
+	entries := newTestLog(t, 2)
+
+	// A size exceeding the end of the stream followed by other entries.
+	garbage := uvarint(32 << 20)
+	data := append(append(append([]byte{}, entries...), garbage...), entries...)
+
+	count, regions := readTestLog(t, data)
+	if count != 4 {
+		t.Errorf("expected 4 entries, got %d", count)
+	}
+
+	if len(regions) != 1 || regions[0].err == errTruncatedEntry || regions[0].size != int64(len(garbage)) {
+		t.Errorf("expected a corrupt entry size of %d bytes, got %v", len(garbage), regions)
+	}
+}
+
+func TestReadStreamProtoLogGarbage(t *testing.T) {
+	entries := newTestLog(t, 2)
+
+	garbage := bytes.Repeat([]byte{0xff, 0xff, 0xff, 0x1f, 0x0a}, 1<<20)
+	data := append(append(append([]byte{}, entries...), garbage...), entries...)
+
+	count, regions := readTestLog(t, data)
+	if count != 4 {
+		t.Errorf("expected 4 entries, got %d", count)
+	}
+
+	if len(regions) != 1 || regions[0].size != int64(len(garbage)) {
+		t.Errorf("expected %d skipped bytes, got %v", len(garbage), regions)
+	}
+}
@@ -5,6 +5,7 @@ import (
 	"errors"
 	"fmt"
 	"os"
+	"strings"
 	"time"
 
 	"github.com/spf13/cobra"
@@ -18,6 +19,35 @@ var (
 
 type application struct {
 	BazelRemoteCache *bzlremotecache.BazelRemoteCache
+	OutputFormat     outputFormat
+
+	openCache func(ctx context.Context, flags *remoteCacheFlags) (*bzlremotecache.BazelRemoteCache, error)
+}
+
+type applicationOption func(*application)
+
+// withCache makes the application use the given cache instead of
+// the one described by the command line flags.
+func withCache(brc *bzlremotecache.BazelRemoteCache) applicationOption {
+	return func(app *application) {
+		app.BazelRemoteCache = brc
+		app.openCache = func(context.Context, *remoteCacheFlags) (*bzlremotecache.BazelRemoteCache, error) {
+			return brc, nil
+		}
+	}
+}
+
+func newApplication(opts ...applicationOption) *application {
+	app := application{
+		OutputFormat: textOutput,
+		openCache:    openRemoteCache,
+	}
+
+	for _, opt := range opts {
+		opt(&app)
+	}
+
+	return &app
 }
 
 func (app *application) Cleanup() {
@@ -27,7 +57,7 @@ func (app *application) Cleanup() {
 }
 
 func main() {
-	var app application
+	app := newApplication()
 	defer app.Cleanup()
 
 	var (
@@ -57,12 +87,17 @@ func main() {
 		&noColorFlag, "no-color", "", false,
 		"Disable color output",
 	)
+	fl.VarP(
+		&app.OutputFormat, "output", "",
+		"Output format (text, json, jsonl or yaml)",
+	)
 	fl.BoolP("help", "h", false, "Show this help and exit")
 
 	cmd.AddCommand(
-		newACCmd(&app),
-		newCASCmd(&app),
-		newLogCmd(&app),
+		newACCmd(app),
+		newCASCmd(app),
+		newActionCmd(app),
+		newLogCmd(app),
 	)
 
 	if err := cmd.Execute(); err != nil {
@@ -71,47 +106,143 @@ func main() {
 	}
 }
 
+// remoteCacheFlags are the command line flags describing the cache to use.
+type remoteCacheFlags struct {
+	remote       string
+	diskCache    string
+	instanceName string
+	tlsOpts      bzlremotecache.TLSOptions
+	headers      []string
+	tokenFile    string
+	credHelper   string
+}
+
 func (app *application) newRemoteCacheCommand(cmd *cobra.Command) *cobra.Command {
-	var (
-		remoteFlag       string
-		instanceNameFlag string
-	)
+	var flags remoteCacheFlags
 
 	oldPreRunE := cmd.PreRunE
 	cmd.PreRunE = func(cmd *cobra.Command, args []string) error {
-		var err error
-
-		ctx, cancel := context.WithTimeout(cmd.Context(), 5*time.Second)
-		defer cancel()
-
-		if remoteFlag == "" {
-			return errors.New("bazel remote cache address not given")
-		}
-
-		app.BazelRemoteCache, err = bzlremotecache.New(
-			ctx, remoteFlag, instanceNameFlag,
-		)
-
-		if err != nil {
-			return err
+		if flags.diskCache != "" && cmd.Flags().Changed("remote") {
+			return errors.New("--remote and --disk-cache can't be used together")
 		}
 
+		// Validate the arguments of the subcommand before connecting.
 		if oldPreRunE != nil {
-			return oldPreRunE(cmd, args)
+			if err := oldPreRunE(cmd, args); err != nil {
+				return err
+			}
 		}
 
-		return nil
+		ctx, cancel := context.WithTimeout(cmd.Context(), 5*time.Second)
+		defer cancel()
+
+		var err error
+		app.BazelRemoteCache, err = app.openCache(ctx, &flags)
+
+		return err
 	}
 
 	fl := cmd.Flags()
 	fl.StringVarP(
-		&remoteFlag, "remote", "r", os.Getenv("BAZEL_REMOTE_CACHE"),
-		"Remote cache URL (<host>:<port>)",
+		&flags.remote, "remote", "r", os.Getenv("BAZEL_REMOTE_CACHE"),
+		"Remote cache URL ([grpc://|grpcs://]<host>:<port> or http[s]://[<user>:<password>@]<host>[:<port>][/<path>])",
 	)
 	fl.StringVarP(
-		&instanceNameFlag, "instance-name", "i", "",
+		&flags.diskCache, "disk-cache", "", "",
+		"Local disk cache directory to read instead of a remote cache "+
+			"(bazel-remote or Bazel --disk_cache layout)",
+	)
+	fl.StringVarP(
+		&flags.instanceName, "instance-name", "i", "",
 		"Instance name of the remote cache",
 	)
+	fl.StringVarP(
+		&flags.tlsOpts.CACertFile, "tls-certificate", "", "",
+		"PEM file of the certificate authorities used to verify the remote cache",
+	)
+	fl.StringVarP(
+		&flags.tlsOpts.ClientCertFile, "tls-client-certificate", "", "",
+		"PEM file of the client certificate used for mutual TLS",
+	)
+	fl.StringVarP(
+		&flags.tlsOpts.ClientKeyFile, "tls-client-key", "", "",
+		"PEM file of the client private key used for mutual TLS",
+	)
+	fl.StringVarP(
+		&flags.tlsOpts.ServerName, "tls-server-name", "", "",
+		"Override the server name used to verify the remote cache certificate",
+	)
+
+	fl.StringArrayVarP(
+		&flags.headers, "remote-header", "", nil,
+		"Header to send to the remote cache (<name>=<value>), can be repeated",
+	)
+	fl.StringVarP(
+		&flags.tokenFile, "bearer-token-file", "", "",
+		"File containing the bearer token to authenticate to the remote cache "+
+			"(default to the BAZEL_REMOTE_CACHE_TOKEN environment variable)",
+	)
+	fl.StringVarP(
+		&flags.credHelper, "credential-helper", "", "",
+		"Bazel credential helper used to get the remote cache headers",
+	)
 
 	return cmd
 }
+
+// openRemoteCache connects to the cache described by the flags.
+func openRemoteCache(ctx context.Context, flags *remoteCacheFlags) (*bzlremotecache.BazelRemoteCache, error) {
+	if flags.diskCache != "" {
+		return bzlremotecache.NewDiskCache(flags.diskCache)
+	}
+
+	if flags.remote == "" {
+		return nil, errors.New("bazel remote cache address not given")
+	}
+
+	opts, err := remoteCacheAuthOptions(flags.headers, flags.tokenFile, flags.credHelper)
+	if err != nil {
+		return nil, err
+	}
+
+	if !flags.tlsOpts.IsZero() {
+		opts = append(opts, bzlremotecache.WithTLS(flags.tlsOpts))
+	}
+
+	return bzlremotecache.New(ctx, flags.remote, flags.instanceName, opts...)
+}
+
+func remoteCacheAuthOptions(headers []string, tokenFile, credHelper string) ([]bzlremotecache.Option, error) {
+	var opts []bzlremotecache.Option
+
+	for _, header := range headers {
+		name, value, found := strings.Cut(header, "=")
+		if !found || name == "" {
+			return nil, fmt.Errorf("invalid remote header %q, expected <name>=<value>", header)
+		}
+
+		opts = append(opts, bzlremotecache.WithHeader(name, value))
+	}
+
+	var token string
+	if tokenFile != "" {
+		content, err := os.ReadFile(tokenFile)
+		if err != nil {
+			return nil, fmt.Errorf("can't read the bearer token file: %v", err)
+		}
+
+		token = strings.TrimSpace(string(content))
+	} else {
+		token = os.Getenv("BAZEL_REMOTE_CACHE_TOKEN")
+	}
+
+	if token != "" {
+		opts = append(opts, bzlremotecache.WithBearerToken(token))
+	}
+
+	if credHelper != "" {
+		opts = append(opts, bzlremotecache.WithCredentialHelper(credHelper))
+	}
+
+	return opts, nil
+}
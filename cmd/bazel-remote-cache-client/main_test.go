@@ -0,0 +1,335 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	remoteexecution "github.com/bazelbuild/remote-apis/build/bazel/remote/execution/v2"
+	"github.com/spf13/cobra"
+	"google.golang.org/protobuf/proto"
+
+	"github.com/leboncoin/bazel-remote-cache-client/pkg/bzlremotecache"
+)
+
+// newTestApp returns an application using an in-memory cache containing
+// the given blobs.
+func newTestApp(t *testing.T, blobs ...[]byte) (*application, *bzlremotecache.MemoryBackend) {
+	t.Helper()
+
+	backend := bzlremotecache.NewMemoryBackend()
+	for _, data := range blobs {
+		digest, err := bzlremotecache.ComputeDigest(bytes.NewReader(data))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if err := backend.WriteBlob(context.Background(), digest, bytes.NewReader(data)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	return newApplication(withCache(bzlremotecache.NewWithBackend(backend))), backend
+}
+
+// runCommand runs a command of the application and returns its output.
+func runCommand(t *testing.T, app *application, args ...string) (string, error) {
+	t.Helper()
+
+	cmd := cobra.Command{
+		Use:           "bazel-remote-cache-client",
+		SilenceUsage:  true,
+		SilenceErrors: true,
+	}
+	cmd.PersistentFlags().VarP(&app.OutputFormat, "output", "", "Output format")
+	cmd.AddCommand(
+		newACCmd(app),
+		newCASCmd(app),
+	)
+	cmd.SetArgs(args)
+
+	var err error
+	output := captureStdout(t, func() {
+		err = cmd.Execute()
+	})
+
+	return output, err
+}
+
+// captureStdout returns what fn prints on the standard output.
+func captureStdout(t *testing.T, fn func()) string {
+	t.Helper()
+
+	stdout, err := os.CreateTemp(t.TempDir(), "stdout")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer func() {
+		_ = stdout.Close()
+	}()
+
+	oldStdout := os.Stdout
+	os.Stdout = stdout
+	fn()
+	os.Stdout = oldStdout
+
+	output, err := os.ReadFile(stdout.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return string(output)
+}
+
+func mustDigest(t *testing.T, data []byte) *bzlremotecache.Digest {
+	t.Helper()
+
+	digest, err := bzlremotecache.ComputeDigest(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return digest
+}
+
+func TestACGet(t *testing.T) {
+	disableColor()
+
+	stdout := []byte("hello\n")
+	content := []byte("content of the output file")
+
+	app, backend := newTestApp(t, stdout, content)
+
+	actionDigest := &bzlremotecache.Digest{
+		Hash: "908085c97f53e58132f07eb7c64118ec05a67ed7ab93102b914e54b96c293488",
+		Size: 142,
+	}
+
+	_, err := backend.UpdateActionResult(context.Background(), actionDigest, &remoteexecution.ActionResult{
+		OutputFiles: []*remoteexecution.OutputFile{{
+			Path:   "bazel-out/bin/app.txt",
+			Digest: mustDigest(t, content).ToProto(),
+		}},
+		ExitCode:     3,
+		StdoutDigest: mustDigest(t, stdout).ToProto(),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	downloadDir := t.TempDir()
+
+	output, err := runCommand(
+		t, app, "ac", "get", "--output", "jsonl", "--show-stdout", "-d", downloadDir, actionDigest.String(),
+	)
+	if err != nil {
+		t.Fatalf("ac get failed: %v", err)
+	}
+
+	var record map[string]interface{}
+	if err := json.Unmarshal([]byte(output), &record); err != nil {
+		t.Fatalf("invalid JSON output %q: %v", output, err)
+	}
+
+	if record["digest"] != actionDigest.String() {
+		t.Errorf("expected the digest %s, got %v", actionDigest, record["digest"])
+	}
+
+	if record["stdout"] != string(stdout) {
+		t.Errorf("expected the stdout %q, got %v", stdout, record["stdout"])
+	}
+
+	if !bytes.Contains([]byte(output), []byte("bazel-out/bin/app.txt")) {
+		t.Errorf("expected the output file in %s", output)
+	}
+
+	downloaded, err := os.ReadFile(filepath.Join(downloadDir, "bazel-out/bin/app.txt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !bytes.Equal(downloaded, content) {
+		t.Errorf("expected the downloaded content %q, got %q", content, downloaded)
+	}
+
+	output, err = runCommand(t, app, "ac", "get", "--output", "text", actionDigest.String())
+	if err != nil {
+		t.Fatalf("ac get failed: %v", err)
+	}
+
+	if !bytes.Contains([]byte(output), []byte(actionDigest.String()+":")) {
+		t.Errorf("expected the action digest in %q", output)
+	}
+}
+
+func TestACGetNotFound(t *testing.T) {
+	disableColor()
+
+	app, _ := newTestApp(t)
+
+	if _, err := runCommand(t, app, "ac", "get", "--output", "text", mustDigest(t, []byte("action")).String()); err == nil {
+		t.Error("expected an error for a missing action result")
+	}
+}
+
+func TestCASGet(t *testing.T) {
+	disableColor()
+
+	small := []byte("small blob")
+	large := bytes.Repeat([]byte("large blob "), 1<<20)
+
+	app, _ := newTestApp(t, small, large)
+
+	output, err := runCommand(t, app, "cas", "get", "--output", "text", mustDigest(t, small).String())
+	if err != nil {
+		t.Fatalf("cas get failed: %v", err)
+	}
+
+	if output != string(small) {
+		t.Errorf("expected the blob content %q, got %q", small, output)
+	}
+
+	outputDir := t.TempDir()
+
+	_, err = runCommand(
+		t, app, "cas", "get", "--output", "text", "-d", outputDir,
+		mustDigest(t, small).String()+"=small.txt",
+		mustDigest(t, large).String()+"=sub/large.txt",
+	)
+	if err != nil {
+		t.Fatalf("cas get failed: %v", err)
+	}
+
+	for path, expected := range map[string][]byte{
+		"small.txt":     small,
+		"sub/large.txt": large,
+	} {
+		data, err := os.ReadFile(filepath.Join(outputDir, path))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if !bytes.Equal(data, expected) {
+			t.Errorf("unexpected content of %s", path)
+		}
+	}
+}
+
+func TestCASGetNotFound(t *testing.T) {
+	disableColor()
+
+	app, _ := newTestApp(t)
+
+	if _, err := runCommand(t, app, "cas", "get", "--output", "text", mustDigest(t, []byte("blob")).String()); err == nil {
+		t.Error("expected an error for a missing blob")
+	}
+}
+
+func TestCASGetSamePath(t *testing.T) {
+	disableColor()
+
+	small := []byte("small blob")
+	large := bytes.Repeat([]byte("large blob "), 1<<20)
+
+	app, _ := newTestApp(t, small, large)
+
+	outputDir := t.TempDir()
+
+	// The same blobs are downloaded once in their output file.
+	_, err := runCommand(
+		t, app, "cas", "get", "--output", "text", "-d", outputDir,
+		mustDigest(t, small).String(), mustDigest(t, small).String(),
+		mustDigest(t, large).String(), mustDigest(t, large).String(),
+	)
+	if err != nil {
+		t.Fatalf("cas get failed: %v", err)
+	}
+
+	data, err := os.ReadFile(filepath.Join(outputDir, mustDigest(t, large).Hash))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !bytes.Equal(data, large) {
+		t.Error("unexpected content of the large blob")
+	}
+
+	// Different blobs can't be downloaded in the same output file.
+	output, err := runCommand(
+		t, app, "cas", "get", "--output", "text", "-d", outputDir,
+		mustDigest(t, large).String()+"=blob", mustDigest(t, small).String()+"=blob",
+	)
+	if err == nil {
+		t.Error("expected an error for different blobs of the same output file")
+	}
+
+	if !bytes.Contains([]byte(output), []byte("conflicting blobs")) {
+		t.Errorf("expected a conflict in %q", output)
+	}
+}
+
+func TestACPutFromACGet(t *testing.T) {
+	disableColor()
+
+	content := []byte("content of the output file")
+
+	app, backend := newTestApp(t, content)
+	ctx := context.Background()
+
+	ar := &remoteexecution.ActionResult{
+		OutputFiles: []*remoteexecution.OutputFile{{
+			Path:         "bazel-out/bin/app.txt",
+			Digest:       mustDigest(t, content).ToProto(),
+			IsExecutable: true,
+		}},
+		ExitCode: 1,
+	}
+
+	digestA := mustDigest(t, []byte("action a"))
+	if _, err := backend.UpdateActionResult(ctx, digestA, ar); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, format := range []string{"json", "jsonl"} {
+		output, err := runCommand(t, app, "ac", "get", "--output", format, digestA.String())
+		if err != nil {
+			t.Fatalf("ac get failed: %v", err)
+		}
+
+		recordPath := filepath.Join(t.TempDir(), "record.json")
+		if err := os.WriteFile(recordPath, []byte(output), 0644); err != nil {
+			t.Fatal(err)
+		}
+
+		digestB := mustDigest(t, []byte("action b "+format))
+		if _, err := runCommand(t, app, "ac", "put", "--output", "text", "--from-file", recordPath, digestB.String()); err != nil {
+			t.Fatalf("ac put failed: %v", err)
+		}
+
+		written, err := backend.GetActionResult(ctx, digestB, bzlremotecache.GetCacheResultOptions{})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if !proto.Equal(written, ar) {
+			t.Errorf("expected the action result %v, got %v", ar, written)
+		}
+	}
+}
+
+func TestInvalidFlagsBeforeConnecting(t *testing.T) {
+	app := newApplication()
+	app.openCache = func(context.Context, *remoteCacheFlags) (*bzlremotecache.BazelRemoteCache, error) {
+		t.Error("unexpected connection to the cache")
+		return nil, errors.New("no cache")
+	}
+
+	if _, err := runCommand(t, app, "cas", "get", "-j", "0", mustDigest(t, []byte("a")).String()); err == nil {
+		t.Error("expected an error for an invalid number of jobs")
+	}
+}
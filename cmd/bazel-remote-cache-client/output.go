@@ -1,14 +1,21 @@
 package main
 
 import (
+	"context"
 	"fmt"
+	"path"
+	"sort"
 	"strings"
 
 	remoteexecution "github.com/bazelbuild/remote-apis/build/bazel/remote/execution/v2"
 	"github.com/bazelbuild/remote-apis/build/bazel/semver"
 	"github.com/fatih/color"
+	"google.golang.org/genproto/googleapis/longrunning"
 	"google.golang.org/grpc/codes"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/timestamppb"
 
+	"github.com/leboncoin/bazel-remote-cache-client/pkg/bzlremotecache"
 	"github.com/leboncoin/bazel-remote-cache-client/pkg/bzlremotelogging"
 )
 
@@ -32,7 +39,34 @@ func disableColor() {
 	color.NoColor = true
 }
 
+// actionResultContent contains the CAS content of an action result
+// fetched to be printed with it.
+type actionResultContent struct {
+	// trees are the trees of the output directories by path.
+	trees map[string]*remoteexecution.Tree
+	// treeErrors are the errors of the trees which can't be fetched by path.
+	treeErrors map[string]error
+
+	// stdout and stderr are the outputs of the action, printed if not nil.
+	stdout, stderr *actionOutput
+}
+
+// actionOutput is the stdout or the stderr of an action.
+type actionOutput struct {
+	data []byte
+	err  error
+
+	// maxLines is the maximum number of printed lines, 0 for no limit.
+	maxLines int
+	// tail prints the last lines instead of the first ones when truncated.
+	tail bool
+}
+
 func printActionResult(prefix string, ar *remoteexecution.ActionResult) {
+	printActionResultWithContent(prefix, ar, nil)
+}
+
+func printActionResultWithContent(prefix string, ar *remoteexecution.ActionResult, content *actionResultContent) {
 	if len(ar.OutputFiles) > 0 {
 		fmt.Printf(prefix+"%s:\n", cf("OutputFiles"))
 		for _, outputFile := range ar.OutputFiles {
@@ -58,6 +92,14 @@ func printActionResult(prefix string, ar *remoteexecution.ActionResult) {
 		fmt.Printf(prefix+"%s:\n", cf("OutputDirectories"))
 		for _, outputDirectory := range ar.OutputDirectories {
 			printOutputDirectory(prefix+"  ", outputDirectory)
+
+			if content != nil {
+				if err := content.treeErrors[outputDirectory.Path]; err != nil {
+					fmt.Printf(prefix+"    |- %s\n", errorColor.Sprint(err))
+				} else if tree := content.trees[outputDirectory.Path]; tree != nil {
+					printTree(prefix+"    ", tree)
+				}
+			}
 		}
 	}
 
@@ -72,12 +114,58 @@ func printActionResult(prefix string, ar *remoteexecution.ActionResult) {
 		fmt.Printf(prefix+"%s: %d\n", cf("ExitCode"), ar.ExitCode)
 	}
 
-	if ar.StdoutDigest != nil && ar.StdoutDigest.SizeBytes > 0 {
-		fmt.Printf(prefix+"%s: %s\n", cf("Stdout"), getColoredDigest(ar.StdoutDigest))
+	if content == nil {
+		content = &actionResultContent{}
+	}
+
+	printStdOutput(prefix, "Stdout", ar.StdoutDigest, ar.StdoutRaw, content.stdout)
+	printStdOutput(prefix, "Stderr", ar.StderrDigest, ar.StderrRaw, content.stderr)
+}
+
+func printStdOutput(prefix, name string, digest *remoteexecution.Digest, raw []byte, output *actionOutput) {
+	switch {
+	case digest != nil && digest.SizeBytes > 0:
+		fmt.Printf(prefix+"%s: %s\n", cf(name), getColoredDigest(digest))
+	case len(raw) > 0:
+		fmt.Printf(prefix+"%s: %s\n", cf(name), faintColor.Sprintf("inlined (%d bytes)", len(raw)))
+	default:
+		return
+	}
+
+	if output == nil {
+		return
+	}
+
+	if output.err != nil {
+		fmt.Printf(prefix+"  |- %s\n", errorColor.Sprint(output.err))
+		return
 	}
 
-	if ar.StderrDigest != nil && ar.StderrDigest.SizeBytes > 0 {
-		fmt.Printf(prefix+"%s: %s\n", cf("Stderr"), getColoredDigest(ar.StderrDigest))
+	lines := strings.SplitAfter(string(output.data), "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+
+	var omitted int
+	if output.maxLines > 0 && len(lines) > output.maxLines {
+		omitted = len(lines) - output.maxLines
+		if output.tail {
+			lines = lines[omitted:]
+		} else {
+			lines = lines[:output.maxLines]
+		}
+	}
+
+	if omitted > 0 && output.tail {
+		fmt.Printf(prefix+"  %s\n", faintColor.Sprintf("... %d lines omitted", omitted))
+	}
+
+	for _, line := range lines {
+		fmt.Printf(prefix+"  %s %s\n", faintColor.Sprint("|"), strings.TrimSuffix(line, "\n"))
+	}
+
+	if omitted > 0 && !output.tail {
+		fmt.Printf(prefix+"  %s\n", faintColor.Sprintf("... %d lines omitted", omitted))
 	}
 }
 
@@ -104,6 +192,248 @@ func printOutputDirectory(prefix string, od *remoteexecution.OutputDirectory) {
 	fmt.Printf(prefix+"  |- %s\n", getColoredDigest(od.TreeDigest))
 }
 
+func printTree(prefix string, tree *remoteexecution.Tree) {
+	getDir, err := bzlremotecache.TreeDirectoryGetter(tree)
+	if err != nil {
+		fmt.Printf(prefix+"|- %s\n", errorColor.Sprint(err))
+		return
+	}
+
+	printDirectory(context.Background(), prefix, tree.Root, getDir)
+}
+
+// printDirectory prints recursively a directory and returns false
+// if a subdirectory can't be retrieved.
+func printDirectory(
+	ctx context.Context, prefix string, dir *remoteexecution.Directory,
+	getDir bzlremotecache.DirectoryGetter,
+) bool {
+	err := bzlremotecache.WalkDirectory(
+		ctx, dir, getDir,
+		func(nodePath string, node proto.Message) error {
+			nodePrefix := prefix + strings.Repeat("  ", strings.Count(nodePath, "/"))
+			name := path.Base(nodePath)
+
+			switch n := node.(type) {
+			case *remoteexecution.FileNode:
+				var isExecutableMarker string
+				if n.IsExecutable {
+					isExecutableMarker = redColor.Sprint("x ")
+				}
+
+				fmt.Printf(nodePrefix+"- %s%s\n", isExecutableMarker, cyanColor.Sprint(name))
+				fmt.Printf(nodePrefix+"  |- %s\n", getColoredDigest(n.Digest))
+			case *remoteexecution.SymlinkNode:
+				fmt.Printf(
+					nodePrefix+"- %s -> %s\n",
+					cyanColor.Sprint(name),
+					cyanColor.Sprint(n.Target),
+				)
+			case *remoteexecution.DirectoryNode:
+				fmt.Printf(nodePrefix+"- %s/\n", cyanColor.Sprint(name))
+			}
+
+			return nil
+		},
+	)
+
+	if err != nil {
+		fmt.Printf(prefix+"|- %s\n", errorColor.Sprint(err))
+		return false
+	}
+
+	return true
+}
+
+func printAction(prefix string, action *remoteexecution.Action) {
+	fmt.Printf(prefix+"%s: %s\n", cf("CommandDigest"), getColoredDigest(action.CommandDigest))
+	fmt.Printf(prefix+"%s: %s\n", cf("InputRootDigest"), getColoredDigest(action.InputRootDigest))
+
+	if action.Timeout != nil {
+		fmt.Printf(prefix+"%s: %s\n", cf("Timeout"), action.Timeout.AsDuration())
+	}
+
+	if action.DoNotCache {
+		fmt.Printf(prefix+"%s: %t\n", cf("DoNotCache"), action.DoNotCache)
+	}
+
+	if len(action.Salt) > 0 {
+		fmt.Printf(prefix+"%s: %x\n", cf("Salt"), action.Salt)
+	}
+
+	printPlatform(prefix, action.Platform)
+}
+
+func printCommand(prefix string, command *remoteexecution.Command) {
+	if len(command.Arguments) > 0 {
+		fmt.Printf(prefix+"%s:\n", cf("Arguments"))
+		for _, arg := range command.Arguments {
+			fmt.Printf(prefix+"  - %s\n", arg)
+		}
+	}
+
+	if len(command.EnvironmentVariables) > 0 {
+		fmt.Printf(prefix+"%s:\n", cf("EnvironmentVariables"))
+		for _, env := range command.EnvironmentVariables {
+			fmt.Printf(prefix+"  - %s=%s\n", yellowColor.Sprint(env.Name), env.Value)
+		}
+	}
+
+	printPlatform(prefix, command.Platform)
+
+	if command.WorkingDirectory != "" {
+		fmt.Printf(prefix+"%s: %s\n", cf("WorkingDirectory"), cyanColor.Sprint(command.WorkingDirectory))
+	}
+
+	for _, paths := range []struct {
+		name  string
+		paths []string
+	}{
+		{"OutputPaths", command.OutputPaths},
+		{"OutputFiles", command.OutputFiles},
+		{"OutputDirectories", command.OutputDirectories},
+		{"OutputNodeProperties", command.OutputNodeProperties},
+	} {
+		if len(paths.paths) > 0 {
+			fmt.Printf(prefix+"%s:\n", cf(paths.name))
+			for _, p := range paths.paths {
+				fmt.Printf(prefix+"  - %s\n", cyanColor.Sprint(p))
+			}
+		}
+	}
+}
+
+func printPlatform(prefix string, platform *remoteexecution.Platform) {
+	if len(platform.GetProperties()) == 0 {
+		return
+	}
+
+	fmt.Printf(prefix+"%s:\n", cf("Platform"))
+	for _, property := range platform.Properties {
+		fmt.Printf(prefix+"  - %s: %s\n", yellowColor.Sprint(property.Name), property.Value)
+	}
+}
+
+func printActionDiff(diff *actionDiff) {
+	fmt.Printf("%s %s\n", redColor.Sprint("---"), acDigestColor.Sprint(diff.digestA))
+	fmt.Printf("%s %s\n", okColor.Sprint("+++"), acDigestColor.Sprint(diff.digestB))
+
+	if diff.IsEmpty() {
+		fmt.Println(faintColor.Sprint("No differences"))
+		return
+	}
+
+	printKeyChanges("", diff.fields)
+	printLineChanges(cf("Arguments"), diff.arguments)
+	if len(diff.environment) > 0 {
+		fmt.Printf("%s:\n", cf("EnvironmentVariables"))
+		printKeyChanges("  ", diff.environment)
+	}
+	if len(diff.actionPlatform) > 0 {
+		fmt.Printf("%s:\n", cf("Platform"))
+		printKeyChanges("  ", diff.actionPlatform)
+	}
+	if len(diff.commandPlatform) > 0 {
+		fmt.Printf("%s:\n", cf("CommandPlatform"))
+		printKeyChanges("  ", diff.commandPlatform)
+	}
+	printLineChanges(cf("OutputPaths"), diff.outputPaths)
+
+	if len(diff.inputs) > 0 {
+		fmt.Printf("%s:\n", cf("Inputs"))
+		for _, change := range diff.inputs {
+			switch {
+			case change.Old == nil:
+				fmt.Printf("  %s %s %s\n", okColor.Sprint("+"), cyanColor.Sprint(change.Path), directoryNodeSummary(change.New))
+			case change.New == nil:
+				fmt.Printf("  %s %s %s\n", redColor.Sprint("-"), cyanColor.Sprint(change.Path), directoryNodeSummary(change.Old))
+			default:
+				fmt.Printf("  %s %s %s -> %s\n", yellowColor.Sprint("~"), cyanColor.Sprint(change.Path),
+					directoryNodeSummary(change.Old), directoryNodeSummary(change.New))
+			}
+		}
+	}
+}
+
+func printKeyChanges(prefix string, changes []keyChange) {
+	for _, change := range changes {
+		switch {
+		case change.old == nil:
+			fmt.Printf(prefix+"%s %s: %s\n", okColor.Sprint("+"), yellowColor.Sprint(change.key), *change.new)
+		case change.new == nil:
+			fmt.Printf(prefix+"%s %s: %s\n", redColor.Sprint("-"), yellowColor.Sprint(change.key), *change.old)
+		default:
+			fmt.Printf(prefix+"%s %s: %s -> %s\n", yellowColor.Sprint("~"), yellowColor.Sprint(change.key), *change.old, *change.new)
+		}
+	}
+}
+
+// lineChangesContext is the number of unchanged lines printed
+// around the changed ones.
+const lineChangesContext = 3
+
+// printLineChanges prints the changed lines with a few unchanged lines around
+// them, like a unified diff, the other unchanged lines being collapsed.
+func printLineChanges(title string, changes []lineChange) {
+	if len(changes) == 0 {
+		return
+	}
+
+	// The unchanged lines are printed when a changed line is close enough.
+	printed := make([]bool, len(changes))
+	for i, change := range changes {
+		if change.op == ' ' {
+			continue
+		}
+
+		for j := i - lineChangesContext; j <= i+lineChangesContext; j++ {
+			if j >= 0 && j < len(changes) {
+				printed[j] = true
+			}
+		}
+	}
+
+	fmt.Printf("%s:\n", title)
+	for i := 0; i < len(changes); i++ {
+		if !printed[i] {
+			end := i
+			for end < len(changes) && !printed[end] {
+				end++
+			}
+
+			fmt.Printf("    %s\n", faintColor.Sprintf("... %d unchanged ...", end-i))
+			i = end - 1
+			continue
+		}
+
+		switch change := changes[i]; change.op {
+		case '+':
+			fmt.Printf("  %s %s\n", okColor.Sprint("+"), okColor.Sprint(change.line))
+		case '-':
+			fmt.Printf("  %s %s\n", redColor.Sprint("-"), redColor.Sprint(change.line))
+		default:
+			fmt.Printf("    %s\n", faintColor.Sprint(change.line))
+		}
+	}
+}
+
+// directoryNodeSummary returns a short description of a directory node.
+func directoryNodeSummary(node proto.Message) string {
+	switch n := node.(type) {
+	case *remoteexecution.FileNode:
+		if n.IsExecutable {
+			return getColoredDigest(n.Digest) + " " + redColor.Sprint("x")
+		}
+		return getColoredDigest(n.Digest)
+	case *remoteexecution.SymlinkNode:
+		return "-> " + cyanColor.Sprint(n.Target)
+	case *remoteexecution.DirectoryNode:
+		return "(directory) " + getColoredDigest(n.Digest)
+	default:
+		return ""
+	}
+}
+
 func printLogEntry(le *bzlremotelogging.LogEntry, showMetadata bool) {
 	startTime := le.StartTime.AsTime().Local()
 	endTime := le.EndTime.AsTime().Local()
@@ -158,6 +488,12 @@ func printLogEntry(le *bzlremotelogging.LogEntry, showMetadata bool) {
 		printWriteDetails(prefix, w)
 	} else if uar := le.Details.GetUpdateActionResult(); uar != nil {
 		printUpdateActionResultDetails(prefix, uar)
+	} else if e := le.Details.GetExecute(); e != nil {
+		printExecuteDetails(prefix, e)
+	} else if we := le.Details.GetWaitExecution(); we != nil {
+		printWaitExecutionDetails(prefix, we)
+	} else if qws := le.Details.GetQueryWriteStatus(); qws != nil {
+		printQueryWriteStatusDetails(prefix, qws)
 	}
 }
 
@@ -208,7 +544,7 @@ func printGetActionResultDetails(prefix string, gar *bzlremotelogging.GetActionR
 
 	fmt.Println(prefix + respPrefix)
 	if gar.Response != nil {
-		printActionResult(prefix+"\t|- ", gar.Response)
+		printLoggedActionResult(prefix+"\t|- ", gar.Response)
 	}
 }
 
@@ -222,7 +558,7 @@ func printUpdateActionResultDetails(prefix string, uar *bzlremotelogging.UpdateA
 	}
 	if uar.Request.ActionResult != nil {
 		fmt.Printf(prefix+"\t|- %s:\n", cf("ActionResult"))
-		printActionResult(prefix+"\t\t|- ", uar.Request.ActionResult)
+		printLoggedActionResult(prefix+"\t\t|- ", uar.Request.ActionResult)
 	}
 	if uar.Request.ResultsCachePolicy != nil {
 		fmt.Printf(prefix+"\t|- %s:\n", cf("ResultsCachePolicy"))
@@ -231,7 +567,7 @@ func printUpdateActionResultDetails(prefix string, uar *bzlremotelogging.UpdateA
 
 	fmt.Println(prefix + respPrefix)
 	if uar.Response != nil {
-		printActionResult(prefix+"\t|- ", uar.Response)
+		printLoggedActionResult(prefix+"\t|- ", uar.Response)
 	}
 }
 
@@ -307,6 +643,175 @@ func printWriteDetails(prefix string, w *bzlremotelogging.WriteDetails) {
 	}
 }
 
+func printExecuteDetails(prefix string, e *bzlremotelogging.ExecuteDetails) {
+	fmt.Println(prefix + reqPrefix)
+	if e.Request.InstanceName != "" {
+		fmt.Printf(prefix+"\t|- %s: %s\n", cf("InstanceName"), e.Request.InstanceName)
+	}
+	if e.Request.ActionDigest != nil {
+		fmt.Printf(prefix+"\t|- %s: %s\n", cf("ActionDigest"), getColoredDigest(e.Request.ActionDigest))
+	}
+	if e.Request.SkipCacheLookup {
+		fmt.Printf(prefix+"\t|- %s: %t\n", cf("SkipCacheLookup"), e.Request.SkipCacheLookup)
+	}
+	if e.Request.ExecutionPolicy != nil {
+		fmt.Printf(prefix+"\t|- %s:\n", cf("ExecutionPolicy"))
+		fmt.Printf(prefix+"\t\t|- %s: %d\n", cf("Priority"), e.Request.ExecutionPolicy.Priority)
+	}
+	if e.Request.ResultsCachePolicy != nil {
+		fmt.Printf(prefix+"\t|- %s:\n", cf("ResultsCachePolicy"))
+		fmt.Printf(prefix+"\t\t|- %s: %d\n", cf("Priority"), e.Request.ResultsCachePolicy.Priority)
+	}
+
+	fmt.Println(prefix + respPrefix)
+	for _, op := range e.Responses {
+		printOperation(prefix+"\t", op)
+	}
+}
+
+func printWaitExecutionDetails(prefix string, we *bzlremotelogging.WaitExecutionDetails) {
+	fmt.Println(prefix + reqPrefix)
+	if we.Request.Name != "" {
+		fmt.Printf(prefix+"\t|- %s: %s\n", cf("Name"), we.Request.Name)
+	}
+
+	fmt.Println(prefix + respPrefix)
+	for _, op := range we.Responses {
+		printOperation(prefix+"\t", op)
+	}
+}
+
+// printOperation prints a longrunning operation streamed by Execute or
+// WaitExecution, its metadata and its result being decoded as
+// ExecuteOperationMetadata and ExecuteResponse.
+func printOperation(prefix string, op *longrunning.Operation) {
+	fmt.Printf(prefix+"- %s: %s\n", cf("Operation"), op.Name)
+	prefix += "  "
+
+	if op.Metadata != nil {
+		var md remoteexecution.ExecuteOperationMetadata
+		if err := op.Metadata.UnmarshalTo(&md); err != nil {
+			fmt.Printf(prefix+"|- %s: %s\n", cf("Metadata"), errorColor.Sprintf("can't decode %s: %v", op.Metadata.TypeUrl, err))
+		} else {
+			fmt.Printf(prefix+"|- %s: %s\n", cf("Stage"), yellowColor.Sprint(md.Stage))
+			if md.ActionDigest != nil {
+				fmt.Printf(prefix+"|- %s: %s\n", cf("ActionDigest"), getColoredDigest(md.ActionDigest))
+			}
+			if md.StdoutStreamName != "" {
+				fmt.Printf(prefix+"|- %s: %s\n", cf("StdoutStreamName"), faintColor.Sprint(md.StdoutStreamName))
+			}
+			if md.StderrStreamName != "" {
+				fmt.Printf(prefix+"|- %s: %s\n", cf("StderrStreamName"), faintColor.Sprint(md.StderrStreamName))
+			}
+		}
+	}
+
+	if op.Done {
+		fmt.Printf(prefix+"|- %s: %t\n", cf("Done"), op.Done)
+	}
+
+	switch result := op.Result.(type) {
+	case *longrunning.Operation_Error:
+		fmt.Printf(prefix+"|- %s: %s\n", cf("Error"), getColoredGRPCCode(result.Error.Code))
+		if result.Error.Message != "" {
+			fmt.Printf(prefix+"   %s: %s\n", cf("Message"), blueColor.Sprint(result.Error.Message))
+		}
+	case *longrunning.Operation_Response:
+		var er remoteexecution.ExecuteResponse
+		if err := result.Response.UnmarshalTo(&er); err != nil {
+			fmt.Printf(prefix+"|- %s: %s\n", cf("Response"), errorColor.Sprintf("can't decode %s: %v", result.Response.TypeUrl, err))
+			return
+		}
+
+		printExecuteResponse(prefix, &er)
+	}
+}
+
+func printExecuteResponse(prefix string, er *remoteexecution.ExecuteResponse) {
+	if er.Status != nil {
+		fmt.Printf(prefix+"|- %s: %s\n", cf("Status"), getColoredGRPCCode(er.Status.Code))
+		if er.Status.Message != "" {
+			fmt.Printf(prefix+"   %s: %s\n", cf("Message"), blueColor.Sprint(er.Status.Message))
+		}
+	}
+	fmt.Printf(prefix+"|- %s: %t\n", cf("CachedResult"), er.CachedResult)
+	if er.Message != "" {
+		fmt.Printf(prefix+"|- %s: %s\n", cf("Message"), blueColor.Sprint(er.Message))
+	}
+
+	if len(er.ServerLogs) > 0 {
+		names := make([]string, 0, len(er.ServerLogs))
+		for name := range er.ServerLogs {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+
+		fmt.Printf(prefix+"|- %s:\n", cf("ServerLogs"))
+		for _, name := range names {
+			logFile := er.ServerLogs[name]
+			fmt.Printf(prefix+"   - %s: %s", yellowColor.Sprint(name), getColoredDigest(logFile.Digest))
+			if logFile.HumanReadable {
+				fmt.Print(" (human readable)")
+			}
+			fmt.Println()
+		}
+	}
+
+	if er.Result != nil {
+		fmt.Printf(prefix+"|- %s:\n", cf("Result"))
+		printLoggedActionResult(prefix+"   ", er.Result)
+	}
+}
+
+// printLoggedActionResult prints an action result of a log entry,
+// with the metadata of its execution.
+func printLoggedActionResult(prefix string, ar *remoteexecution.ActionResult) {
+	printActionResult(prefix, ar)
+
+	if ar.ExecutionMetadata != nil {
+		printExecutionMetadata(prefix, ar.ExecutionMetadata)
+	}
+}
+
+// printExecutionMetadata prints the worker and the timings of an execution.
+func printExecutionMetadata(prefix string, md *remoteexecution.ExecutedActionMetadata) {
+	fmt.Printf(prefix+"%s:\n", cf("ExecutionMetadata"))
+	if md.Worker != "" {
+		fmt.Printf(prefix+"  %s: %s\n", cf("Worker"), md.Worker)
+	}
+	if md.QueuedTimestamp != nil {
+		fmt.Printf(prefix+"  %s: %s\n", cf("Queued"),
+			magentaColor.Sprint(md.QueuedTimestamp.AsTime().Local().Format("02 Jan 2006 15:04:05.000")))
+	}
+
+	printExecutionPhase(prefix+"  ", "QueueDuration", md.QueuedTimestamp, md.WorkerStartTimestamp)
+	printExecutionPhase(prefix+"  ", "InputFetch", md.InputFetchStartTimestamp, md.InputFetchCompletedTimestamp)
+	printExecutionPhase(prefix+"  ", "Execution", md.ExecutionStartTimestamp, md.ExecutionCompletedTimestamp)
+	printExecutionPhase(prefix+"  ", "OutputUpload", md.OutputUploadStartTimestamp, md.OutputUploadCompletedTimestamp)
+	printExecutionPhase(prefix+"  ", "WorkerTotal", md.WorkerStartTimestamp, md.WorkerCompletedTimestamp)
+}
+
+func printExecutionPhase(prefix, name string, start, end *timestamppb.Timestamp) {
+	if start == nil || end == nil {
+		return
+	}
+
+	fmt.Printf(prefix+"%s: %s\n", cf(name), end.AsTime().Sub(start.AsTime()))
+}
+
+func printQueryWriteStatusDetails(prefix string, qws *bzlremotelogging.QueryWriteStatusDetails) {
+	fmt.Println(prefix + reqPrefix)
+	if qws.Request.ResourceName != "" {
+		fmt.Printf(prefix+"\t|- %s: %s\n", cf("ResourceName"), faintColor.Sprint(qws.Request.ResourceName))
+	}
+
+	fmt.Println(prefix + respPrefix)
+	if qws.Response != nil {
+		fmt.Printf(prefix+"\t|- %s: %d\n", cf("CommittedSize"), qws.Response.CommittedSize)
+		fmt.Printf(prefix+"\t|- %s: %t\n", cf("Complete"), qws.Response.Complete)
+	}
+}
+
 func printFindMissingBlobsDetails(prefix string, fmb *bzlremotelogging.FindMissingBlobsDetails) {
 	fmt.Println(prefix + reqPrefix)
 	if fmb.Request.InstanceName != "" {
@@ -344,6 +849,173 @@ func printFindMissingBlobsDetails(prefix string, fmb *bzlremotelogging.FindMissi
 	}
 }
 
+func printLogDiff(diff *logDiff) {
+	fmt.Printf("%s %s\n", redColor.Sprint("---"), cyanColor.Sprint(diff.runA.path))
+	fmt.Printf("%s %s\n", okColor.Sprint("+++"), cyanColor.Sprint(diff.runB.path))
+
+	if diff.IsEmpty() {
+		fmt.Println(faintColor.Sprint("No differences"))
+		return
+	}
+
+	if len(diff.changedDigests) > 0 {
+		fmt.Printf("%s:\n", cf("Changed action digests"))
+		for _, pair := range diff.changedDigests {
+			fmt.Printf("  %s\n", loggedActionName(pair.a))
+			for _, digest := range pair.a.digests {
+				fmt.Printf("    %s %s\n", redColor.Sprint("-"), acDigestColor.Sprint(digest))
+			}
+			for _, digest := range pair.b.digests {
+				fmt.Printf("    %s %s\n", okColor.Sprint("+"), acDigestColor.Sprint(digest))
+			}
+		}
+	}
+
+	printActionPairs(fmt.Sprintf("Cache hit in %s only", diff.runA.path), diff.hitOnlyInA)
+	printActionPairs(fmt.Sprintf("Cache hit in %s only", diff.runB.path), diff.hitOnlyInB)
+	printLoggedActions(fmt.Sprintf("Actions only in %s", diff.runA.path), diff.onlyInA)
+	printLoggedActions(fmt.Sprintf("Actions only in %s", diff.runB.path), diff.onlyInB)
+	printUploadedBlobs(fmt.Sprintf("Uploaded only in %s", diff.runA.path), diff.uploadsOnlyInA)
+	printUploadedBlobs(fmt.Sprintf("Uploaded only in %s", diff.runB.path), diff.uploadsOnlyInB)
+}
+
+func printActionPairs(title string, pairs []actionPair) {
+	if len(pairs) == 0 {
+		return
+	}
+
+	fmt.Printf("%s:\n", cf(title))
+	for _, pair := range pairs {
+		fmt.Printf("  %s\n", loggedActionName(pair.a))
+	}
+}
+
+func printLoggedActions(title string, actions []*loggedAction) {
+	if len(actions) == 0 {
+		return
+	}
+
+	fmt.Printf("%s:\n", cf(title))
+	for _, action := range actions {
+		fmt.Printf("  %s\n", loggedActionName(action))
+	}
+}
+
+func printUploadedBlobs(title string, uploads []uploadedBlob) {
+	if len(uploads) == 0 {
+		return
+	}
+
+	fmt.Printf("%s:\n", cf(title))
+	for _, upload := range uploads {
+		fmt.Printf("  %s %s\n", faintColor.Sprint(upload.digest), loggedActionName(upload.action))
+	}
+}
+
+// loggedActionName returns the target, the mnemonic and the ID of an action.
+func loggedActionName(action *loggedAction) string {
+	name := yellowColor.Sprint(action.targetID)
+	if action.mnemonic != "" {
+		name += " " + magentaColor.Sprint(action.mnemonic)
+	}
+	if action.actionID != "" {
+		name += " " + faintColor.Sprintf("(%s)", action.actionID)
+	}
+
+	return name
+}
+
+func printLogStats(stats *logStats) {
+	fmt.Printf("%s: %d\n", cf("Entries"), stats.entries)
+	if stats.entries == 0 {
+		return
+	}
+
+	fmt.Printf("%s: %s - %s (%s)\n", cf("Period"),
+		magentaColor.Sprint(stats.firstTime.Local().Format("02 Jan 2006 15:04:05.000")),
+		magentaColor.Sprint(stats.lastTime.Local().Format("02 Jan 2006 15:04:05.000")),
+		stats.lastTime.Sub(stats.firstTime),
+	)
+
+	fmt.Printf("%s:\n", cf("Methods"))
+	for _, ms := range stats.sortedMethods() {
+		fmt.Printf("  %s: %d calls\n", getColoredGRPCMethod(ms.method), len(ms.durations))
+
+		statusCodes := make([]codes.Code, 0, len(ms.codes))
+		for code := range ms.codes {
+			statusCodes = append(statusCodes, code)
+		}
+		sort.Slice(statusCodes, func(i, j int) bool {
+			return statusCodes[i] < statusCodes[j]
+		})
+
+		statuses := make([]string, len(statusCodes))
+		for i, code := range statusCodes {
+			statuses[i] = fmt.Sprintf("%s: %d", getColoredGRPCCode(int32(code)), ms.codes[code])
+		}
+
+		fmt.Printf("    %s: %s\n", cf("Status"), strings.Join(statuses, ", "))
+		fmt.Printf("    %s: p50 %s, p90 %s, p99 %s, max %s\n", cf("Latency"),
+			ms.percentile(50), ms.percentile(90), ms.percentile(99), ms.percentile(100))
+	}
+
+	if stats.acHits+stats.acMisses > 0 {
+		fmt.Printf("%s: %s hits, %s misses (%.1f%% hit ratio)\n", cf("ActionCache"),
+			okColor.Sprint(stats.acHits), faintColor.Sprint(stats.acMisses), stats.acHitRatio()*100)
+	}
+
+	fmt.Printf("%s: %s\n", cf("BytesRead"), formatBytes(stats.bytesRead))
+	fmt.Printf("%s: %s\n", cf("BytesWritten"), formatBytes(stats.bytesWritten))
+
+	if len(stats.slowest.calls) > 0 {
+		fmt.Printf("%s:\n", cf("SlowestCalls"))
+		for _, call := range stats.slowest.calls {
+			printLoggedCall("  ", call, call.duration.String())
+		}
+	}
+
+	if len(stats.largest.calls) > 0 {
+		fmt.Printf("%s:\n", cf("LargestTransfers"))
+		for _, call := range stats.largest.calls {
+			printLoggedCall("  ", call, formatBytes(call.bytes))
+		}
+	}
+}
+
+func printLoggedCall(prefix string, call *loggedCall, value string) {
+	fmt.Printf(prefix+"- %s [%s] %s - %s", boldColor.Sprint(value),
+		magentaColor.Sprint(call.startTime.Local().Format("15:04:05.000")),
+		getColoredGRPCMethod(call.method),
+		getColoredGRPCCode(int32(call.code)),
+	)
+	if call.resource != "" {
+		fmt.Printf(" %s", faintColor.Sprint(call.resource))
+	}
+	if call.targetID != "" {
+		fmt.Printf(" %s", yellowColor.Sprint(call.targetID))
+	}
+	if call.mnemonic != "" {
+		fmt.Printf(" %s", magentaColor.Sprint(call.mnemonic))
+	}
+	fmt.Println()
+}
+
+// formatBytes returns a size in bytes in a human-readable format.
+func formatBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+
+	return fmt.Sprintf("%.1f %ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
+
 func cf(name string) string {
 	return boldColor.Sprint(name)
 }
@@ -0,0 +1,243 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"sigs.k8s.io/yaml"
+
+	"github.com/leboncoin/bazel-remote-cache-client/pkg/bzlremotecache"
+)
+
+// outputFormat is the format of the command outputs.
+type outputFormat string
+
+const (
+	textOutput  outputFormat = "text"
+	jsonOutput  outputFormat = "json"
+	jsonlOutput outputFormat = "jsonl"
+	yamlOutput  outputFormat = "yaml"
+)
+
+// String implements pflag.Value.
+func (f *outputFormat) String() string {
+	return string(*f)
+}
+
+// Set implements pflag.Value.
+func (f *outputFormat) Set(s string) error {
+	switch outputFormat(s) {
+	case textOutput, jsonOutput, jsonlOutput, yamlOutput:
+		*f = outputFormat(s)
+		return nil
+	default:
+		return fmt.Errorf("unsupported output format %q, expected text, json, jsonl or yaml", s)
+	}
+}
+
+// Type implements pflag.Value.
+func (f *outputFormat) Type() string {
+	return "format"
+}
+
+// IsStructured reports whether the output is machine-readable.
+func (f outputFormat) IsStructured() bool {
+	return f != textOutput
+}
+
+// recordWriter writes records in a machine-readable format: a JSON array,
+// one JSON object per line or a stream of YAML documents.
+type recordWriter struct {
+	format outputFormat
+	w      io.Writer
+	count  int
+}
+
+func newRecordWriter(format outputFormat) *recordWriter {
+	return &recordWriter{
+		format: format,
+		w:      os.Stdout,
+	}
+}
+
+// Write writes a record, which must be serializable to JSON.
+func (rw *recordWriter) Write(record interface{}) error {
+	var err error
+
+	switch rw.format {
+	case jsonOutput:
+		var data []byte
+		if data, err = json.MarshalIndent(record, "  ", "  "); err != nil {
+			return err
+		}
+
+		sep := ",\n  "
+		if rw.count == 0 {
+			sep = "[\n  "
+		}
+
+		_, err = fmt.Fprintf(rw.w, "%s%s", sep, data)
+	case jsonlOutput:
+		var data []byte
+		if data, err = json.Marshal(record); err != nil {
+			return err
+		}
+
+		_, err = fmt.Fprintf(rw.w, "%s\n", data)
+	case yamlOutput:
+		var data []byte
+		if data, err = yaml.Marshal(record); err != nil {
+			return err
+		}
+
+		_, err = fmt.Fprintf(rw.w, "---\n%s", data)
+	}
+
+	rw.count++
+
+	return err
+}
+
+// Close terminates the output.
+func (rw *recordWriter) Close() error {
+	if rw.format != jsonOutput {
+		return nil
+	}
+
+	var err error
+	if rw.count == 0 {
+		_, err = fmt.Fprintln(rw.w, "[]")
+	} else {
+		_, err = fmt.Fprintln(rw.w, "\n]")
+	}
+
+	return err
+}
+
+// protoRecord returns the record of a proto message, with the proto field
+// names and the digests in the form hash/size.
+func protoRecord(m proto.Message) (interface{}, error) {
+	data, err := protojson.MarshalOptions{UseProtoNames: true}.Marshal(m)
+	if err != nil {
+		return nil, err
+	}
+
+	var record interface{}
+	if err := json.Unmarshal(data, &record); err != nil {
+		return nil, err
+	}
+
+	return replaceDigests(record), nil
+}
+
+// replaceDigests replaces the JSON objects of remote execution API digests
+// by their string form hash/size.
+func replaceDigests(v interface{}) interface{} {
+	switch value := v.(type) {
+	case map[string]interface{}:
+		if isDigestRecord(value) {
+			size, _ := value["size_bytes"].(string)
+			if size == "" {
+				size = "0"
+			}
+
+			return fmt.Sprintf("%s/%s", value["hash"], size)
+		}
+
+		for k, child := range value {
+			value[k] = replaceDigests(child)
+		}
+	case []interface{}:
+		for i, child := range value {
+			value[i] = replaceDigests(child)
+		}
+	}
+
+	return v
+}
+
+// restoreDigests replaces the string form hash/size of the digests written by
+// replaceDigests by their JSON objects, for the fields named like digests.
+func restoreDigests(v interface{}) interface{} {
+	switch value := v.(type) {
+	case map[string]interface{}:
+		for k, child := range value {
+			if s, ok := child.(string); ok && (k == "digest" || strings.HasSuffix(k, "_digest")) {
+				if digest, err := bzlremotecache.ParseDigestFromString(s); err == nil {
+					value[k] = map[string]interface{}{
+						"hash":       digest.Hash,
+						"size_bytes": fmt.Sprint(digest.Size),
+					}
+
+					continue
+				}
+			}
+
+			value[k] = restoreDigests(child)
+		}
+	case []interface{}:
+		for i, child := range value {
+			value[i] = restoreDigests(child)
+		}
+	}
+
+	return v
+}
+
+// actionResultJSON returns the protojson ActionResult described in JSON,
+// either directly or by a record written by ac get with the json or jsonl
+// output, as a single record or a list of one record.
+func actionResultJSON(data []byte) ([]byte, error) {
+	var v interface{}
+	if err := json.Unmarshal(data, &v); err != nil {
+		return nil, err
+	}
+
+	if records, ok := v.([]interface{}); ok {
+		if len(records) != 1 {
+			return nil, fmt.Errorf("expected a single record, got %d", len(records))
+		}
+
+		v = records[0]
+	}
+
+	record, ok := v.(map[string]interface{})
+	if !ok {
+		return nil, errors.New("expected a JSON object")
+	}
+
+	if _, ok := record["digest"]; !ok {
+		return data, nil
+	}
+
+	if errMsg, ok := record["error"].(string); ok {
+		return nil, fmt.Errorf("the record is an error: %s", errMsg)
+	}
+
+	ar, ok := record["action_result"]
+	if !ok {
+		return nil, errors.New("no action_result in the record")
+	}
+
+	return json.Marshal(restoreDigests(ar))
+}
+
+func isDigestRecord(m map[string]interface{}) bool {
+	if _, ok := m["hash"].(string); !ok {
+		return false
+	}
+
+	for k := range m {
+		if k != "hash" && k != "size_bytes" {
+			return false
+		}
+	}
+
+	return true
+}
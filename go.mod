@@ -5,10 +5,12 @@ go 1.18
 require (
 	github.com/bazelbuild/remote-apis v0.0.0-20220510175640-3b4b64021035
 	github.com/fatih/color v1.13.0
+	github.com/klauspost/compress v1.15.15
 	github.com/spf13/cobra v1.4.0
 	google.golang.org/genproto v0.0.0-20220602131408-e326c6e8e9c8
 	google.golang.org/grpc v1.47.0
 	google.golang.org/protobuf v1.28.0
+	sigs.k8s.io/yaml v1.3.0
 )
 
 require (
@@ -20,4 +22,5 @@ require (
 	golang.org/x/net v0.0.0-20220531201128-c960675eff93 // indirect
 	golang.org/x/sys v0.0.0-20220520151302-bc2c85ada10a // indirect
 	golang.org/x/text v0.3.7 // indirect
+	gopkg.in/yaml.v2 v2.4.0 // indirect
 )
@@ -0,0 +1,38 @@
+package bzlremotecache
+
+import (
+	"context"
+
+	remoteexecution "github.com/bazelbuild/remote-apis/build/bazel/remote/execution/v2"
+)
+
+// GetAction returns the Action proto stored in the CAS.
+func (brc *BazelRemoteCache) GetAction(ctx context.Context, digest *Digest) (*remoteexecution.Action, error) {
+	var action remoteexecution.Action
+	if err := brc.GetProto(ctx, digest, &action); err != nil {
+		return nil, err
+	}
+
+	return &action, nil
+}
+
+// GetCommand returns the Command proto stored in the CAS.
+func (brc *BazelRemoteCache) GetCommand(ctx context.Context, digest *Digest) (*remoteexecution.Command, error) {
+	var command remoteexecution.Command
+	if err := brc.GetProto(ctx, digest, &command); err != nil {
+		return nil, err
+	}
+
+	return &command, nil
+}
+
+// GetDirectory returns the Directory proto stored in the CAS.
+// It can be used as a DirectoryGetter to walk an input root.
+func (brc *BazelRemoteCache) GetDirectory(ctx context.Context, digest *Digest) (*remoteexecution.Directory, error) {
+	var dir remoteexecution.Directory
+	if err := brc.GetProto(ctx, digest, &dir); err != nil {
+		return nil, err
+	}
+
+	return &dir, nil
+}
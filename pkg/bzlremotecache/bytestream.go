@@ -0,0 +1,166 @@
+package bzlremotecache
+
+import (
+	"context"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+
+	"google.golang.org/genproto/googleapis/bytestream"
+)
+
+const (
+	// defaultMaxBatchSize is the maximum size of batch requests when the
+	// remote cache doesn't advertise one, matching the default maximum
+	// message size of gRPC.
+	defaultMaxBatchSize = 4 * 1024 * 1024
+
+	// batchRequestOverhead is the room kept in batch requests
+	// for the message fields other than the blob data.
+	batchRequestOverhead = 1024
+
+	// batchBlobOverhead is the room kept in batch requests
+	// for the digest and the status of each blob.
+	batchBlobOverhead = 128
+
+	// writeChunkSize is the size of the chunks of the blobs written with
+	// the ByteStream API.
+	writeChunkSize = 64 * 1024
+)
+
+// blobResourceName returns the ByteStream resource name to read the given blob.
+func (gb *grpcBackend) blobResourceName(digest *Digest) string {
+	return path.Join(gb.instanceName, "blobs", digest.Hash, fmt.Sprint(digest.Size))
+}
+
+// ReadBlob writes the content of a blob read with the ByteStream API
+// from the given offset, and returns the number of written bytes.
+func (gb *grpcBackend) ReadBlob(ctx context.Context, digest *Digest, offset int64, w io.Writer) (int64, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	stream, err := gb.bs.Read(ctx, &bytestream.ReadRequest{
+		ResourceName: gb.blobResourceName(digest),
+		ReadOffset:   offset,
+	})
+
+	if err != nil {
+		return 0, err
+	}
+
+	var written int64
+	for {
+		resp, err := stream.Recv()
+		if errors.Is(err, io.EOF) {
+			break
+		} else if err != nil {
+			return written, err
+		}
+
+		n, err := w.Write(resp.Data)
+		written += int64(n)
+
+		if err != nil {
+			return written, err
+		}
+	}
+
+	// A stream ending early isn't an error for gRPC.
+	if expected := digest.Size - offset; written != expected {
+		return written, fmt.Errorf("read %d bytes of blob %s from offset %d, expected %d", written, digest, offset, expected)
+	}
+
+	return written, nil
+}
+
+// uploadResourceName returns a new ByteStream resource name to write the given blob.
+func (gb *grpcBackend) uploadResourceName(digest *Digest) (string, error) {
+	var uuid [16]byte
+	if _, err := rand.Read(uuid[:]); err != nil {
+		return "", err
+	}
+
+	// Random UUID (version 4).
+	uuid[6] = uuid[6]&0x0f | 0x40
+	uuid[8] = uuid[8]&0x3f | 0x80
+
+	return path.Join(
+		gb.instanceName, "uploads",
+		fmt.Sprintf("%x-%x-%x-%x-%x", uuid[0:4], uuid[4:6], uuid[6:8], uuid[8:10], uuid[10:]),
+		"blobs", digest.Hash, fmt.Sprint(digest.Size),
+	), nil
+}
+
+// WriteBlob writes the content of a blob read from r with the ByteStream API.
+func (gb *grpcBackend) WriteBlob(ctx context.Context, digest *Digest, r io.Reader) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	resourceName, err := gb.uploadResourceName(digest)
+	if err != nil {
+		return err
+	}
+
+	stream, err := gb.bs.Write(ctx)
+	if err != nil {
+		return err
+	}
+
+	buf := make([]byte, writeChunkSize)
+
+	var offset int64
+	for {
+		n, err := io.ReadFull(r, buf)
+		if err != nil && !errors.Is(err, io.EOF) && !errors.Is(err, io.ErrUnexpectedEOF) {
+			return err
+		}
+
+		req := bytestream.WriteRequest{
+			WriteOffset: offset,
+			FinishWrite: err != nil,
+			Data:        buf[:n],
+		}
+
+		// The resource name is only required in the first request.
+		if offset == 0 {
+			req.ResourceName = resourceName
+		}
+
+		// The stream is closed by the server when the blob already exists.
+		if sendErr := stream.Send(&req); errors.Is(sendErr, io.EOF) {
+			break
+		} else if sendErr != nil {
+			return sendErr
+		}
+
+		offset += int64(n)
+		if req.FinishWrite {
+			break
+		}
+	}
+
+	resp, err := stream.CloseAndRecv()
+	if err != nil {
+		return err
+	}
+
+	if resp.CommittedSize != digest.Size {
+		return fmt.Errorf("%d bytes committed by the remote cache, expected %d", resp.CommittedSize, digest.Size)
+	}
+
+	return nil
+}
+
+// countingWriter counts the bytes written to the underlying writer.
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (cw *countingWriter) Write(p []byte) (int, error) {
+	n, err := cw.w.Write(p)
+	cw.n += int64(n)
+	return n, err
+}
@@ -0,0 +1,88 @@
+package bzlremotecache
+
+import (
+	"bytes"
+	"context"
+	"net"
+	"testing"
+
+	"google.golang.org/genproto/googleapis/bytestream"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+// truncatingByteStream is a ByteStream server returning
+// the first bytes of its blob only.
+type truncatingByteStream struct {
+	bytestream.UnimplementedByteStreamServer
+
+	data []byte
+	size int
+}
+
+func (bs *truncatingByteStream) Read(req *bytestream.ReadRequest, stream bytestream.ByteStream_ReadServer) error {
+	return stream.Send(&bytestream.ReadResponse{Data: bs.data[req.ReadOffset:bs.size]})
+}
+
+// newTestGRPCCache returns a client of a gRPC cache serving the given
+// ByteStream server.
+func newTestGRPCCache(t *testing.T, bs bytestream.ByteStreamServer) *BazelRemoteCache {
+	t.Helper()
+
+	listener := bufconn.Listen(1 << 20)
+
+	server := grpc.NewServer()
+	bytestream.RegisterByteStreamServer(server, bs)
+
+	go func() {
+		_ = server.Serve(listener)
+	}()
+
+	t.Cleanup(server.Stop)
+
+	client, err := grpc.DialContext(
+		context.Background(), "bufconn",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return listener.DialContext(ctx)
+		}),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	brc := NewWithBackend(newGRPCBackend(client, ""))
+	t.Cleanup(brc.Close)
+
+	return brc
+}
+
+func TestGRPCReadBlobTruncated(t *testing.T) {
+	data := bytes.Repeat([]byte("a"), 1024)
+
+	digest, err := ComputeDigest(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	bs := truncatingByteStream{data: data, size: len(data) / 2}
+	brc := newTestGRPCCache(t, &bs)
+
+	var buf bytes.Buffer
+	if _, err := brc.backend.ReadBlob(context.Background(), digest, 0, &buf); err == nil {
+		t.Error("expected an error for a truncated blob")
+	}
+
+	bs.size = len(data)
+	buf.Reset()
+
+	n, err := brc.backend.ReadBlob(context.Background(), digest, 100, &buf)
+	if err != nil {
+		t.Fatalf("read failed: %v", err)
+	}
+
+	if n != int64(len(data)-100) || !bytes.Equal(buf.Bytes(), data[100:]) {
+		t.Errorf("expected %d bytes, got %d", len(data)-100, n)
+	}
+}
@@ -1,93 +1,357 @@
 package bzlremotecache
 
 import (
+	"bytes"
 	"context"
 	"errors"
 	"fmt"
+	"io"
 	"os"
+	"strings"
+	"sync"
 
 	remoteexecution "github.com/bazelbuild/remote-apis/build/bazel/remote/execution/v2"
-	gcode "google.golang.org/genproto/googleapis/rpc/code"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
 	"google.golang.org/grpc/credentials/insecure"
 	"google.golang.org/grpc/status"
 )
 
 // BazelRemoteCache is a client of a Bazel remote cache.
 type BazelRemoteCache struct {
-	client       *grpc.ClientConn
-	instanceName string
+	backend Backend
 
-	ac  remoteexecution.ActionCacheClient
-	cas remoteexecution.ContentAddressableStorageClient
+	cacheCapabilitiesOnce sync.Once
+	cacheCapabilities     *remoteexecution.CacheCapabilities
+}
+
+// Backend is the storage accessed by a BazelRemoteCache: a remote cache
+// accessed with gRPC, a local disk cache or an in-memory cache.
+type Backend interface {
+	// GetActionResult returns an action result stored in the action cache.
+	GetActionResult(ctx context.Context, digest *Digest, opts GetCacheResultOptions) (*remoteexecution.ActionResult, error)
+	// UpdateActionResult stores an action result in the action cache,
+	// and returns the stored action result.
+	UpdateActionResult(
+		ctx context.Context, digest *Digest, ar *remoteexecution.ActionResult,
+	) (*remoteexecution.ActionResult, error)
+
+	// FindMissingBlobs returns the given blobs which aren't stored in the CAS.
+	FindMissingBlobs(ctx context.Context, digests []*Digest) ([]*Digest, error)
+	// BatchReadBlobs fills the data of the given results with a single request.
+	BatchReadBlobs(ctx context.Context, results []BlobResult)
+	// BatchUpdateBlobs stores the data of the given results with a single
+	// request, and fills their errors.
+	BatchUpdateBlobs(ctx context.Context, results []BlobResult)
+	// ReadBlob writes the content of a blob from the given offset, and
+	// returns the number of written bytes.
+	ReadBlob(ctx context.Context, digest *Digest, offset int64, w io.Writer) (int64, error)
+	// WriteBlob stores the content of a blob read from r.
+	WriteBlob(ctx context.Context, digest *Digest, r io.Reader) error
+
+	// Capabilities returns the cache capabilities of the backend.
+	Capabilities(ctx context.Context) (*remoteexecution.CacheCapabilities, error)
+	// Close releases the resources of the backend.
+	Close() error
+}
+
+// NewWithBackend creates a client of the given backend.
+func NewWithBackend(backend Backend) *BazelRemoteCache {
+	return &BazelRemoteCache{
+		backend: backend,
+	}
+}
+
+// defaultCacheCapabilities returns the cache capabilities of the backends
+// which don't advertise them.
+func defaultCacheCapabilities(updateEnabled bool) *remoteexecution.CacheCapabilities {
+	return &remoteexecution.CacheCapabilities{
+		DigestFunctions: []remoteexecution.DigestFunction_Value{
+			remoteexecution.DigestFunction_SHA256,
+		},
+		ActionCacheUpdateCapabilities: &remoteexecution.ActionCacheUpdateCapabilities{
+			UpdateEnabled: updateEnabled,
+		},
+	}
+}
+
+// Option configures the client of a Bazel remote cache.
+type Option func(*options)
+
+type options struct {
+	tls              *TLSOptions
+	headers          map[string][]string
+	credentialHelper string
+}
+
+// WithTLS enables TLS with the given configuration
+// to connect to the remote cache.
+func WithTLS(tlsOpts TLSOptions) Option {
+	return func(o *options) {
+		o.tls = &tlsOpts
+	}
+}
+
+// WithHeader adds a header to every request sent to the remote cache.
+func WithHeader(name, value string) Option {
+	return func(o *options) {
+		if o.headers == nil {
+			o.headers = make(map[string][]string)
+		}
+
+		name = strings.ToLower(name)
+		o.headers[name] = append(o.headers[name], value)
+	}
+}
+
+// WithBearerToken authenticates every request sent to the remote cache
+// with the given bearer token.
+func WithBearerToken(token string) Option {
+	return WithHeader("authorization", "Bearer "+token)
+}
+
+// WithCredentialHelper gets the headers to send to the remote cache
+// from the given credential helper, following the Bazel credential
+// helper protocol.
+func WithCredentialHelper(path string) Option {
+	return func(o *options) {
+		o.credentialHelper = path
+	}
 }
 
 // New creates a new client to access of a Bazel remote cache.
-func New(ctx context.Context, remote string, instanceName string) (*BazelRemoteCache, error) {
-	client, err := grpc.DialContext(
-		ctx, remote,
-		grpc.WithTransportCredentials(
-			insecure.NewCredentials(),
-		),
+//
+// The remote address can be prefixed by the grpc:// or grpcs:// scheme,
+// the latter enabling TLS even if no TLS option is given. The http:// and
+// https:// schemes select the HTTP caching protocol.
+func New(ctx context.Context, remote string, instanceName string, opts ...Option) (*BazelRemoteCache, error) {
+	var o options
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	scheme, target, err := parseRemote(remote)
+	if err != nil {
+		return nil, err
+	}
+
+	if scheme == "http" || scheme == "https" {
+		backend, err := newHTTPBackend(remote, instanceName, &o)
+		if err != nil {
+			return nil, err
+		}
+
+		return NewWithBackend(backend), nil
+	}
+
+	var creds credentials.TransportCredentials
+	switch {
+	case o.tls != nil && scheme == "grpc":
+		return nil, errors.New("TLS options given for a grpc:// remote cache, use grpcs:// instead")
+	case o.tls != nil:
+		creds, err = newTLSCredentials(o.tls)
+	case scheme == "grpcs":
+		creds, err = newTLSCredentials(&TLSOptions{})
+	default:
+		creds = insecure.NewCredentials()
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	dialOpts := []grpc.DialOption{
+		grpc.WithTransportCredentials(creds),
 		grpc.WithUserAgent("bazel-remote-cache-client"),
-	)
+	}
+
+	if len(o.headers) > 0 || o.credentialHelper != "" {
+		rpcCreds := perRPCCredentials{
+			headers: o.headers,
+		}
+
+		if o.credentialHelper != "" {
+			uri := remote
+			if scheme == "" {
+				uri = "grpc://" + remote
+			}
+
+			rpcCreds.helper = &credentialHelper{
+				path: o.credentialHelper,
+				uri:  uri,
+			}
+		}
+
+		dialOpts = append(dialOpts, grpc.WithPerRPCCredentials(&rpcCreds))
+	}
+
+	client, err := grpc.DialContext(ctx, target, dialOpts...)
 
 	if err != nil {
 		return nil, fmt.Errorf("can't connect to the remote cache: %v", err)
 	}
 
-	return &BazelRemoteCache{
-		client:       client,
-		instanceName: instanceName,
+	return NewWithBackend(newGRPCBackend(client, instanceName)), nil
+}
 
-		ac:  remoteexecution.NewActionCacheClient(client),
-		cas: remoteexecution.NewContentAddressableStorageClient(client),
-	}, nil
+// GetCacheResultOptions are the options of GetCacheResult.
+type GetCacheResultOptions struct {
+	// InlineStdout and InlineStderr request the remote cache to inline
+	// the stdout and the stderr in the action result, which it may
+	// ignore depending on their size.
+	InlineStdout bool
+	InlineStderr bool
 }
 
 // GetCacheResult returns the given ActionCache stored in the Bazel remote cache.
-func (brc *BazelRemoteCache) GetCacheResult(ctx context.Context, digest string) (*remoteexecution.ActionResult, error) {
-	return brc.ac.GetActionResult(ctx, &remoteexecution.GetActionResultRequest{
-		InstanceName: brc.instanceName,
-		ActionDigest: &remoteexecution.Digest{
-			Hash:      digest,
-			SizeBytes: 1,
-		},
-	})
+func (brc *BazelRemoteCache) GetCacheResult(
+	ctx context.Context, digest *Digest, opts GetCacheResultOptions,
+) (*remoteexecution.ActionResult, error) {
+	return brc.backend.GetActionResult(ctx, digest, opts)
+}
+
+// UpdateActionResult stores the given ActionResult in the Bazel remote cache,
+// and returns the stored one.
+func (brc *BazelRemoteCache) UpdateActionResult(
+	ctx context.Context, digest *Digest, ar *remoteexecution.ActionResult,
+) (*remoteexecution.ActionResult, error) {
+	return brc.backend.UpdateActionResult(ctx, digest, ar)
 }
 
 // GetBlob returns the content of a Bazel remote cache blob.
 func (brc *BazelRemoteCache) GetBlob(ctx context.Context, digest *Digest) ([]byte, error) {
-	resp, err := brc.cas.BatchReadBlobs(ctx, &remoteexecution.BatchReadBlobsRequest{
-		InstanceName: brc.instanceName,
-		Digests: []*remoteexecution.Digest{
-			{
-				Hash:      digest.Hash,
-				SizeBytes: digest.Size,
-			},
-		},
-	})
+	// The size comes from the user or the cache, so the buffer is only
+	// preallocated up to the default maximum batch size, and grows beyond.
+	var buf bytes.Buffer
+	switch {
+	case digest.Size > defaultMaxBatchSize:
+		buf.Grow(defaultMaxBatchSize)
+	case digest.Size > 0:
+		buf.Grow(int(digest.Size))
+	}
 
-	if err != nil {
+	if err := brc.ReadBlob(ctx, digest, &buf); err != nil {
 		return nil, err
 	}
 
-	if len(resp.Responses) != 1 {
-		return nil, errors.New("no reponses from the remote cache")
+	return buf.Bytes(), nil
+}
+
+// BlobResult is the result of a blob read by GetBlobs.
+type BlobResult struct {
+	Digest *Digest
+	Data   []byte
+	Err    error
+}
+
+// GetBlobs returns the content of several Bazel remote cache blobs,
+// in the order of the given digests. The blobs are read with as few
+// batch requests as allowed by the maximum batch size of the remote
+// cache, so they must be batchable (see IsBatchable).
+func (brc *BazelRemoteCache) GetBlobs(ctx context.Context, digests []*Digest) []BlobResult {
+	results := make([]BlobResult, len(digests))
+	brc.GetBlobsFunc(ctx, digests, func(i int, r BlobResult) {
+		results[i] = r
+	})
+
+	return results
+}
+
+// GetBlobsFunc reads several Bazel remote cache blobs like GetBlobs, but
+// calls fn with the index and the result of each blob once its batch
+// request returns, so that the blobs of a batch can be released before
+// reading the next one.
+func (brc *BazelRemoteCache) GetBlobsFunc(ctx context.Context, digests []*Digest, fn func(int, BlobResult)) {
+	maxSize := brc.maxBatchSize(ctx) - batchRequestOverhead
+
+	for start := 0; start < len(digests); {
+		end := start
+		var size int64
+		for end < len(digests) && (end == start || size+digests[end].Size+batchBlobOverhead <= maxSize) {
+			size += digests[end].Size + batchBlobOverhead
+			end++
+		}
+
+		results := make([]BlobResult, end-start)
+		for i := range results {
+			results[i].Digest = digests[start+i]
+		}
+
+		brc.backend.BatchReadBlobs(ctx, results)
+
+		for i, r := range results {
+			fn(start+i, r)
+		}
+
+		start = end
 	}
+}
 
-	r := resp.Responses[0]
+// maxBatchSize returns the maximum total size of batch requests
+// supported by the cache, bounded by the gRPC maximum message size.
+func (brc *BazelRemoteCache) maxBatchSize(ctx context.Context) int64 {
+	cc := brc.getCacheCapabilities(ctx)
+	if cc == nil || cc.MaxBatchTotalSizeBytes <= 0 || cc.MaxBatchTotalSizeBytes > defaultMaxBatchSize {
+		return defaultMaxBatchSize
+	}
 
-	switch gcode.Code(r.Status.GetCode()) {
-	case gcode.Code_OK:
-	case gcode.Code_NOT_FOUND:
-		return nil, errors.New("blob not found")
-	default:
-		return nil, fmt.Errorf("error %v", r.Status)
+	return cc.MaxBatchTotalSizeBytes
+}
+
+// getCacheCapabilities returns the cache capabilities of the backend,
+// or nil if they can't be retrieved. They are only requested once.
+func (brc *BazelRemoteCache) getCacheCapabilities(ctx context.Context) *remoteexecution.CacheCapabilities {
+	brc.cacheCapabilitiesOnce.Do(func() {
+		if cc, err := brc.backend.Capabilities(ctx); err == nil {
+			brc.cacheCapabilities = cc
+		}
+	})
+
+	return brc.cacheCapabilities
+}
+
+// IsBatchable returns whether the given blob is small enough
+// to be read with a batch request.
+func (brc *BazelRemoteCache) IsBatchable(ctx context.Context, digest *Digest) bool {
+	return digest.Size+batchBlobOverhead <= brc.maxBatchSize(ctx)-batchRequestOverhead
+}
+
+// ReadBlob writes the content of a Bazel remote cache blob to w.
+//
+// Small blobs are read with a batch request while the blobs exceeding
+// the maximum batch size of the remote cache are streamed, with the
+// ByteStream API for a gRPC remote cache.
+func (brc *BazelRemoteCache) ReadBlob(ctx context.Context, digest *Digest, w io.Writer) error {
+	if brc.IsBatchable(ctx, digest) {
+		r := brc.GetBlobs(ctx, []*Digest{digest})[0]
+		if r.Err != nil {
+			return r.Err
+		}
+
+		_, err := w.Write(r.Data)
+		return err
+	}
+
+	_, err := brc.backend.ReadBlob(ctx, digest, 0, w)
+	return err
+}
+
+// ReadBlobFrom writes the content of a Bazel remote cache blob to w,
+// starting at the given offset. It returns the number of written bytes,
+// which can be used to resume the read after a failure.
+func (brc *BazelRemoteCache) ReadBlobFrom(ctx context.Context, digest *Digest, offset int64, w io.Writer) (int64, error) {
+	if offset == 0 {
+		cw := countingWriter{w: w}
+		err := brc.ReadBlob(ctx, digest, &cw)
+		return cw.n, err
+	}
+
+	if offset >= digest.Size {
+		return 0, nil
 	}
 
-	return r.Data, nil
+	return brc.backend.ReadBlob(ctx, digest, offset, w)
 }
 
 // ErrorMsg returns the error message of the given error.
@@ -107,9 +371,25 @@ func (brc *BazelRemoteCache) ErrorMsg(err error) string {
 	return errMsg
 }
 
+// parseRemote splits the given remote address into its scheme,
+// empty if not given, and its gRPC target or HTTP host and path.
+func parseRemote(remote string) (string, string, error) {
+	scheme, target, found := strings.Cut(remote, "://")
+	if !found {
+		return "", remote, nil
+	}
+
+	switch scheme {
+	case "grpc", "grpcs", "http", "https":
+		return scheme, target, nil
+	default:
+		return "", "", fmt.Errorf("unsupported remote cache scheme %q", scheme)
+	}
+}
+
 // Close closed the client of a Bazel remote cache.
 func (brc *BazelRemoteCache) Close() {
-	if err := brc.client.Close(); err != nil {
-		fmt.Fprintf(os.Stderr, "Warning: Can't close gRPC client: %v\n", err)
+	if err := brc.backend.Close(); err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: Can't close the cache client: %v\n", err)
 	}
 }
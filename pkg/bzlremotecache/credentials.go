@@ -0,0 +1,120 @@
+package bzlremotecache
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
+)
+
+// perRPCCredentials adds authentication headers to every request
+// sent to the remote cache.
+type perRPCCredentials struct {
+	headers map[string][]string
+	helper  *credentialHelper
+}
+
+// GetRequestMetadata implements credentials.PerRPCCredentials.
+func (c *perRPCCredentials) GetRequestMetadata(ctx context.Context, _ ...string) (map[string]string, error) {
+	md := make(map[string]string, len(c.headers))
+	for name, values := range c.headers {
+		md[name] = strings.Join(values, ", ")
+	}
+
+	if c.helper != nil {
+		headers, err := c.helper.Headers(ctx)
+		if err != nil {
+			return nil, err
+		}
+
+		for name, values := range headers {
+			md[strings.ToLower(name)] = strings.Join(values, ", ")
+		}
+	}
+
+	return md, nil
+}
+
+// RequireTransportSecurity implements credentials.PerRPCCredentials.
+//
+// Credentials are also sent over plaintext connections
+// as local remote caches are usually not secured.
+func (c *perRPCCredentials) RequireTransportSecurity() bool {
+	return false
+}
+
+// credentialHelper gets request headers from a credential helper
+// following the Bazel credential helper protocol.
+type credentialHelper struct {
+	path string
+	uri  string
+
+	mu      sync.Mutex
+	headers map[string][]string
+	expires time.Time
+}
+
+type credentialHelperRequest struct {
+	URI string `json:"uri"`
+}
+
+type credentialHelperResponse struct {
+	Headers map[string][]string `json:"headers"`
+	Expires string              `json:"expires,omitempty"`
+}
+
+// Headers returns the headers given by the credential helper.
+// They are cached until their expiration.
+func (ch *credentialHelper) Headers(ctx context.Context) (map[string][]string, error) {
+	ch.mu.Lock()
+	defer ch.mu.Unlock()
+
+	if ch.headers != nil && (ch.expires.IsZero() || time.Now().Before(ch.expires)) {
+		return ch.headers, nil
+	}
+
+	req, err := json.Marshal(credentialHelperRequest{URI: ch.uri})
+	if err != nil {
+		return nil, err
+	}
+
+	var stdout, stderr bytes.Buffer
+
+	cmd := exec.CommandContext(ctx, ch.path, "get")
+	cmd.Stdin = bytes.NewReader(req)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf(
+			"credential helper %s failed: %v: %s",
+			ch.path, err, strings.TrimSpace(stderr.String()),
+		)
+	}
+
+	var resp credentialHelperResponse
+	if err := json.Unmarshal(stdout.Bytes(), &resp); err != nil {
+		return nil, fmt.Errorf("invalid response of the credential helper %s: %v", ch.path, err)
+	}
+
+	var expires time.Time
+	if resp.Expires != "" {
+		expires, err = time.Parse(time.RFC3339, resp.Expires)
+		if err != nil {
+			return nil, fmt.Errorf("invalid expiration of the credential helper %s: %v", ch.path, err)
+		}
+	}
+
+	if resp.Headers == nil {
+		resp.Headers = map[string][]string{}
+	}
+
+	ch.headers = resp.Headers
+	ch.expires = expires
+
+	return ch.headers, nil
+}
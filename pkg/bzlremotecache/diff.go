@@ -0,0 +1,111 @@
+package bzlremotecache
+
+import (
+	"context"
+	"path"
+	"sort"
+
+	remoteexecution "github.com/bazelbuild/remote-apis/build/bazel/remote/execution/v2"
+	"google.golang.org/protobuf/proto"
+)
+
+// DirectoryChange is a node which differs between two directories.
+// Old is nil if the node has been added, New is nil if it has been removed.
+// The nodes are a *FileNode, a *DirectoryNode or a *SymlinkNode of the
+// remote execution API.
+type DirectoryChange struct {
+	Path string
+	Old  proto.Message
+	New  proto.Message
+}
+
+// DiffDirectories returns the nodes which differ between two directories,
+// sorted by path. The subdirectories having the same digest are skipped,
+// the other ones are compared recursively.
+func DiffDirectories(
+	ctx context.Context, oldDir, newDir *remoteexecution.Directory, getDir DirectoryGetter,
+) ([]DirectoryChange, error) {
+	var changes []DirectoryChange
+	if err := diffDirectories(ctx, "", oldDir, newDir, getDir, &changes); err != nil {
+		return nil, err
+	}
+
+	return changes, nil
+}
+
+func diffDirectories(
+	ctx context.Context, dirPath string, oldDir, newDir *remoteexecution.Directory,
+	getDir DirectoryGetter, changes *[]DirectoryChange,
+) error {
+	oldNodes := directoryNodes(oldDir)
+	newNodes := directoryNodes(newDir)
+
+	names := make([]string, 0, len(oldNodes)+len(newNodes))
+	for name := range oldNodes {
+		names = append(names, name)
+	}
+	for name := range newNodes {
+		if _, ok := oldNodes[name]; !ok {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		nodePath := path.Join(dirPath, name)
+		oldNode, newNode := oldNodes[name], newNodes[name]
+
+		oldSubdir, oldIsDir := oldNode.(*remoteexecution.DirectoryNode)
+		newSubdir, newIsDir := newNode.(*remoteexecution.DirectoryNode)
+
+		if oldIsDir && newIsDir {
+			if proto.Equal(oldSubdir.Digest, newSubdir.Digest) {
+				continue
+			}
+
+			oldChild, err := getDir(ctx, DigestFromProto(oldSubdir.Digest))
+			if err != nil {
+				return err
+			}
+
+			newChild, err := getDir(ctx, DigestFromProto(newSubdir.Digest))
+			if err != nil {
+				return err
+			}
+
+			if err := diffDirectories(ctx, nodePath, oldChild, newChild, getDir, changes); err != nil {
+				return err
+			}
+
+			continue
+		}
+
+		if oldNode != nil && newNode != nil && proto.Equal(oldNode, newNode) {
+			continue
+		}
+
+		*changes = append(*changes, DirectoryChange{
+			Path: nodePath,
+			Old:  oldNode,
+			New:  newNode,
+		})
+	}
+
+	return nil
+}
+
+// directoryNodes returns the nodes of a directory by name.
+func directoryNodes(dir *remoteexecution.Directory) map[string]proto.Message {
+	nodes := make(map[string]proto.Message, len(dir.Files)+len(dir.Directories)+len(dir.Symlinks))
+	for _, file := range dir.Files {
+		nodes[file.Name] = file
+	}
+	for _, subdir := range dir.Directories {
+		nodes[subdir.Name] = subdir
+	}
+	for _, symlink := range dir.Symlinks {
+		nodes[symlink.Name] = symlink
+	}
+
+	return nodes
+}
@@ -1,9 +1,14 @@
 package bzlremotecache
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
+	"io"
 	"strconv"
 	"strings"
+
+	remoteexecution "github.com/bazelbuild/remote-apis/build/bazel/remote/execution/v2"
 )
 
 // Digest contains the hash and the size of a blob.
@@ -30,3 +35,56 @@ func ParseDigestFromString(s string) (*Digest, error) {
 		Size: size,
 	}, nil
 }
+
+// ParseDigestFromResourceName parses the digest of a ByteStream resource name,
+// e.g. "[<instance>/]blobs/<hash>/<size>" for reads
+// or "[<instance>/]uploads/<uuid>/blobs/<hash>/<size>[/<metadata>]" for writes.
+func ParseDigestFromResourceName(name string) (*Digest, error) {
+	parts := strings.Split(name, "/")
+	for i, part := range parts {
+		switch {
+		case part == "blobs" && i+2 < len(parts):
+			return ParseDigestFromString(parts[i+1] + "/" + parts[i+2])
+		case part == "compressed-blobs" && i+3 < len(parts):
+			return ParseDigestFromString(parts[i+2] + "/" + parts[i+3])
+		}
+	}
+
+	return nil, fmt.Errorf("no digest found in resource name %s", name)
+}
+
+// ComputeDigest computes the SHA-256 digest of the content read from r.
+func ComputeDigest(r io.Reader) (*Digest, error) {
+	h := sha256.New()
+
+	size, err := io.Copy(h, r)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Digest{
+		Hash: hex.EncodeToString(h.Sum(nil)),
+		Size: size,
+	}, nil
+}
+
+// String returns the digest in the form hash/size.
+func (d *Digest) String() string {
+	return fmt.Sprintf("%s/%d", d.Hash, d.Size)
+}
+
+// DigestFromProto returns the digest of a remote execution API digest.
+func DigestFromProto(d *remoteexecution.Digest) *Digest {
+	return &Digest{
+		Hash: d.GetHash(),
+		Size: d.GetSizeBytes(),
+	}
+}
+
+// ToProto returns the remote execution API digest of the digest.
+func (d *Digest) ToProto() *remoteexecution.Digest {
+	return &remoteexecution.Digest{
+		Hash:      d.Hash,
+		SizeBytes: d.Size,
+	}
+}
@@ -0,0 +1,326 @@
+package bzlremotecache
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	remoteexecution "github.com/bazelbuild/remote-apis/build/bazel/remote/execution/v2"
+	"github.com/klauspost/compress/zstd"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+)
+
+// Kinds of entries of a disk cache, named after their directory.
+const (
+	acKind  = "ac"
+	casKind = "cas"
+)
+
+// NewDiskCache creates a client reading a local disk cache directory.
+//
+// Both the layout of bazel-remote, "<kind>.v2/<hash[:2]>/<hash>-<size>-<random>",
+// and the layout of the Bazel --disk_cache, "<kind>/<hash[:2]>/<hash>", are
+// supported.
+func NewDiskCache(dir string) (*BazelRemoteCache, error) {
+	fi, err := os.Stat(dir)
+	if err != nil {
+		return nil, fmt.Errorf("can't open the disk cache: %v", err)
+	}
+
+	if !fi.IsDir() {
+		return nil, fmt.Errorf("the disk cache %s isn't a directory", dir)
+	}
+
+	return NewWithBackend(&diskBackend{
+		dir: dir,
+	}), nil
+}
+
+// errReadOnlyDiskCache is returned by the writes to a disk cache, which
+// could be out of sync with the index of a running cache.
+var errReadOnlyDiskCache = status.Error(codes.Unimplemented, "the disk cache is read-only")
+
+// diskBackend is a read-only local disk cache.
+type diskBackend struct {
+	dir string
+}
+
+func (db *diskBackend) GetActionResult(
+	ctx context.Context, digest *Digest, opts GetCacheResultOptions,
+) (*remoteexecution.ActionResult, error) {
+	data, err := db.readFile(acKind, digest)
+	if err != nil {
+		return nil, err
+	}
+
+	var ar remoteexecution.ActionResult
+	if err := proto.Unmarshal(data, &ar); err != nil {
+		return nil, fmt.Errorf("can't decode the action result: %v", err)
+	}
+
+	// Inline the outputs like a remote cache would do.
+	if opts.InlineStdout && ar.StdoutDigest != nil && len(ar.StdoutRaw) == 0 {
+		if ar.StdoutRaw, err = db.readFile(casKind, DigestFromProto(ar.StdoutDigest)); err != nil {
+			ar.StdoutRaw = nil
+		}
+	}
+
+	if opts.InlineStderr && ar.StderrDigest != nil && len(ar.StderrRaw) == 0 {
+		if ar.StderrRaw, err = db.readFile(casKind, DigestFromProto(ar.StderrDigest)); err != nil {
+			ar.StderrRaw = nil
+		}
+	}
+
+	return &ar, nil
+}
+
+func (db *diskBackend) UpdateActionResult(
+	ctx context.Context, digest *Digest, ar *remoteexecution.ActionResult,
+) (*remoteexecution.ActionResult, error) {
+	return nil, errReadOnlyDiskCache
+}
+
+func (db *diskBackend) FindMissingBlobs(ctx context.Context, digests []*Digest) ([]*Digest, error) {
+	var missing []*Digest
+	for _, digest := range digests {
+		if _, err := db.findFile(casKind, digest); status.Code(err) == codes.NotFound {
+			missing = append(missing, digest)
+		} else if err != nil {
+			return nil, err
+		}
+	}
+
+	return missing, nil
+}
+
+func (db *diskBackend) BatchReadBlobs(ctx context.Context, results []BlobResult) {
+	for i := range results {
+		results[i].Data, results[i].Err = db.readFile(casKind, results[i].Digest)
+	}
+}
+
+func (db *diskBackend) BatchUpdateBlobs(ctx context.Context, results []BlobResult) {
+	for i := range results {
+		results[i].Err = errReadOnlyDiskCache
+	}
+}
+
+func (db *diskBackend) ReadBlob(ctx context.Context, digest *Digest, offset int64, w io.Writer) (int64, error) {
+	r, err := db.open(casKind, digest)
+	if err != nil {
+		return 0, err
+	}
+
+	defer func() {
+		_ = r.Close()
+	}()
+
+	if offset > 0 {
+		if _, err := io.CopyN(io.Discard, r, offset); err != nil {
+			return 0, err
+		}
+	}
+
+	return io.Copy(w, r)
+}
+
+func (db *diskBackend) WriteBlob(ctx context.Context, digest *Digest, r io.Reader) error {
+	return errReadOnlyDiskCache
+}
+
+func (db *diskBackend) Capabilities(ctx context.Context) (*remoteexecution.CacheCapabilities, error) {
+	return defaultCacheCapabilities(false), nil
+}
+
+func (db *diskBackend) Close() error {
+	return nil
+}
+
+// readFile returns the content of an entry.
+func (db *diskBackend) readFile(kind string, digest *Digest) ([]byte, error) {
+	r, err := db.open(kind, digest)
+	if err != nil {
+		return nil, err
+	}
+
+	defer func() {
+		_ = r.Close()
+	}()
+
+	return io.ReadAll(r)
+}
+
+// open opens an entry, decompressing it if needed.
+func (db *diskBackend) open(kind string, digest *Digest) (io.ReadCloser, error) {
+	filePath, err := db.findFile(kind, digest)
+	if err != nil {
+		return nil, err
+	}
+
+	f, err := os.Open(filePath)
+	if err != nil {
+		return nil, err
+	}
+
+	if !strings.HasSuffix(filePath, ".v1") {
+		return f, nil
+	}
+
+	r, err := newCompressedBlobReader(f)
+	if err != nil {
+		_ = f.Close()
+		return nil, fmt.Errorf("can't read %s: %v", filePath, err)
+	}
+
+	return r, nil
+}
+
+// findFile returns the path of the most recent file of an entry.
+//
+// The size of the action cache entries of bazel-remote is the size of the
+// stored action result, so they are looked up by hash only.
+func (db *diskBackend) findFile(kind string, digest *Digest) (string, error) {
+	if len(digest.Hash) < 2 || strings.ContainsAny(digest.Hash, `/\*?[`) {
+		return "", status.Errorf(codes.InvalidArgument, "invalid hash %q", digest.Hash)
+	}
+
+	pattern := digest.Hash + "-*"
+	if kind == casKind {
+		pattern = fmt.Sprintf("%s-%d-*", digest.Hash, digest.Size)
+	}
+
+	matches, err := filepath.Glob(filepath.Join(db.dir, kind+".v2", digest.Hash[:2], pattern))
+	if err != nil {
+		return "", err
+	}
+
+	var (
+		newest     string
+		newestTime time.Time
+	)
+
+	for _, match := range matches {
+		fi, err := os.Stat(match)
+		if err != nil || !fi.Mode().IsRegular() {
+			continue
+		}
+
+		if newest == "" || fi.ModTime().After(newestTime) {
+			newest = match
+			newestTime = fi.ModTime()
+		}
+	}
+
+	if newest != "" {
+		return newest, nil
+	}
+
+	filePath := filepath.Join(db.dir, kind, digest.Hash[:2], digest.Hash)
+	if _, err := os.Stat(filePath); err == nil {
+		return filePath, nil
+	} else if !errors.Is(err, fs.ErrNotExist) {
+		return "", err
+	}
+
+	return "", status.Errorf(codes.NotFound, "%s entry %s not found in the disk cache", kind, digest)
+}
+
+// Compression types of the compressed blobs of bazel-remote.
+const (
+	compressionIdentity = 0
+	compressionZstd     = 1
+)
+
+// compressedBlobHeaderSize is the size of the fixed part of the header of
+// the compressed blobs of bazel-remote.
+const compressedBlobHeaderSize = 8 + 1 + 4
+
+var zstdFrameMagic = []byte{0x28, 0xb5, 0x2f, 0xfd}
+
+// compressedBlobReader reads a compressed blob of bazel-remote.
+//
+// Its header contains, in little endian, the uncompressed size (int64), the
+// compression type (uint8), the chunk size (uint32) and the offsets of the
+// chunks (int64). The chunks are zstd frames, or the raw data without
+// compression.
+type compressedBlobReader struct {
+	io.Reader
+	f   *os.File
+	dec *zstd.Decoder
+}
+
+func newCompressedBlobReader(f *os.File) (*compressedBlobReader, error) {
+	var header [compressedBlobHeaderSize]byte
+	if _, err := io.ReadFull(f, header[:]); err != nil {
+		return nil, fmt.Errorf("invalid compressed blob header: %v", err)
+	}
+
+	size := int64(binary.LittleEndian.Uint64(header[0:8]))
+	compression := header[8]
+	chunkSize := int64(binary.LittleEndian.Uint32(header[9:13]))
+
+	if size < 0 || chunkSize <= 0 {
+		return nil, errors.New("invalid compressed blob header")
+	}
+
+	switch compression {
+	case compressionIdentity:
+		fi, err := f.Stat()
+		if err != nil {
+			return nil, err
+		}
+
+		// The data is at the end of the file, after the chunk offsets.
+		if _, err := f.Seek(fi.Size()-size, io.SeekStart); err != nil {
+			return nil, err
+		}
+
+		return &compressedBlobReader{
+			Reader: io.LimitReader(f, size),
+			f:      f,
+		}, nil
+	case compressionZstd:
+		// The first frame follows the chunk offsets.
+		numChunks := (size + chunkSize - 1) / chunkSize
+		br := bufio.NewReader(f)
+		if _, err := br.Discard(int(8 * (numChunks + 1))); err != nil {
+			return nil, fmt.Errorf("invalid compressed blob header: %v", err)
+		}
+
+		if magic, _ := br.Peek(len(zstdFrameMagic)); size > 0 && !bytes.Equal(magic, zstdFrameMagic) {
+			return nil, errors.New("invalid compressed blob: zstd frame not found")
+		}
+
+		dec, err := zstd.NewReader(br)
+		if err != nil {
+			return nil, err
+		}
+
+		return &compressedBlobReader{
+			Reader: io.LimitReader(dec, size),
+			f:      f,
+			dec:    dec,
+		}, nil
+	default:
+		return nil, fmt.Errorf("unsupported compression type %d", compression)
+	}
+}
+
+func (cbr *compressedBlobReader) Close() error {
+	if cbr.dec != nil {
+		cbr.dec.Close()
+	}
+
+	return cbr.f.Close()
+}
@@ -0,0 +1,191 @@
+package bzlremotecache
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	remoteexecution "github.com/bazelbuild/remote-apis/build/bazel/remote/execution/v2"
+	"google.golang.org/genproto/googleapis/bytestream"
+	gcode "google.golang.org/genproto/googleapis/rpc/code"
+	"google.golang.org/grpc"
+)
+
+// grpcBackend is a remote cache accessed with the gRPC remote execution API.
+type grpcBackend struct {
+	client       *grpc.ClientConn
+	instanceName string
+
+	ac           remoteexecution.ActionCacheClient
+	cas          remoteexecution.ContentAddressableStorageClient
+	bs           bytestream.ByteStreamClient
+	capabilities remoteexecution.CapabilitiesClient
+}
+
+func newGRPCBackend(client *grpc.ClientConn, instanceName string) *grpcBackend {
+	return &grpcBackend{
+		client:       client,
+		instanceName: instanceName,
+
+		ac:           remoteexecution.NewActionCacheClient(client),
+		cas:          remoteexecution.NewContentAddressableStorageClient(client),
+		bs:           bytestream.NewByteStreamClient(client),
+		capabilities: remoteexecution.NewCapabilitiesClient(client),
+	}
+}
+
+func (gb *grpcBackend) GetActionResult(
+	ctx context.Context, digest *Digest, opts GetCacheResultOptions,
+) (*remoteexecution.ActionResult, error) {
+	return gb.ac.GetActionResult(ctx, &remoteexecution.GetActionResultRequest{
+		InstanceName: gb.instanceName,
+		ActionDigest: &remoteexecution.Digest{
+			Hash:      digest.Hash,
+			SizeBytes: digest.Size,
+		},
+		InlineStdout: opts.InlineStdout,
+		InlineStderr: opts.InlineStderr,
+	})
+}
+
+func (gb *grpcBackend) UpdateActionResult(
+	ctx context.Context, digest *Digest, ar *remoteexecution.ActionResult,
+) (*remoteexecution.ActionResult, error) {
+	return gb.ac.UpdateActionResult(ctx, &remoteexecution.UpdateActionResultRequest{
+		InstanceName: gb.instanceName,
+		ActionDigest: digest.ToProto(),
+		ActionResult: ar,
+	})
+}
+
+func (gb *grpcBackend) FindMissingBlobs(ctx context.Context, digests []*Digest) ([]*Digest, error) {
+	req := remoteexecution.FindMissingBlobsRequest{
+		InstanceName: gb.instanceName,
+		BlobDigests:  make([]*remoteexecution.Digest, len(digests)),
+	}
+
+	for i, digest := range digests {
+		req.BlobDigests[i] = digest.ToProto()
+	}
+
+	resp, err := gb.cas.FindMissingBlobs(ctx, &req)
+	if err != nil {
+		return nil, err
+	}
+
+	missing := make([]*Digest, len(resp.MissingBlobDigests))
+	for i, d := range resp.MissingBlobDigests {
+		missing[i] = DigestFromProto(d)
+	}
+
+	return missing, nil
+}
+
+func (gb *grpcBackend) BatchReadBlobs(ctx context.Context, results []BlobResult) {
+	req := remoteexecution.BatchReadBlobsRequest{
+		InstanceName: gb.instanceName,
+		Digests:      make([]*remoteexecution.Digest, len(results)),
+	}
+
+	indexes := make(map[Digest][]int, len(results))
+	for i, r := range results {
+		req.Digests[i] = &remoteexecution.Digest{
+			Hash:      r.Digest.Hash,
+			SizeBytes: r.Digest.Size,
+		}
+		indexes[*r.Digest] = append(indexes[*r.Digest], i)
+	}
+
+	resp, err := gb.cas.BatchReadBlobs(ctx, &req)
+	if err != nil {
+		for i := range results {
+			results[i].Err = err
+		}
+		return
+	}
+
+	for _, r := range resp.Responses {
+		digest := Digest{Hash: r.Digest.GetHash(), Size: r.Digest.GetSizeBytes()}
+
+		var err error
+		switch gcode.Code(r.Status.GetCode()) {
+		case gcode.Code_OK:
+		case gcode.Code_NOT_FOUND:
+			err = errors.New("blob not found")
+		default:
+			err = fmt.Errorf("error %v", r.Status)
+		}
+
+		for _, i := range indexes[digest] {
+			results[i].Data = r.Data
+			results[i].Err = err
+		}
+		delete(indexes, digest)
+	}
+
+	for _, missing := range indexes {
+		for _, i := range missing {
+			results[i].Err = errors.New("no reponses from the remote cache")
+		}
+	}
+}
+
+func (gb *grpcBackend) BatchUpdateBlobs(ctx context.Context, results []BlobResult) {
+	req := remoteexecution.BatchUpdateBlobsRequest{
+		InstanceName: gb.instanceName,
+		Requests:     make([]*remoteexecution.BatchUpdateBlobsRequest_Request, len(results)),
+	}
+
+	indexes := make(map[Digest][]int, len(results))
+	for i, r := range results {
+		req.Requests[i] = &remoteexecution.BatchUpdateBlobsRequest_Request{
+			Digest: r.Digest.ToProto(),
+			Data:   r.Data,
+		}
+		indexes[*r.Digest] = append(indexes[*r.Digest], i)
+	}
+
+	resp, err := gb.cas.BatchUpdateBlobs(ctx, &req)
+	if err != nil {
+		for i := range results {
+			results[i].Err = err
+		}
+		return
+	}
+
+	for _, r := range resp.Responses {
+		digest := Digest{Hash: r.Digest.GetHash(), Size: r.Digest.GetSizeBytes()}
+
+		var err error
+		if gcode.Code(r.Status.GetCode()) != gcode.Code_OK {
+			err = fmt.Errorf("error %v", r.Status)
+		}
+
+		for _, i := range indexes[digest] {
+			results[i].Err = err
+		}
+		delete(indexes, digest)
+	}
+
+	for _, missing := range indexes {
+		for _, i := range missing {
+			results[i].Err = errors.New("no reponses from the remote cache")
+		}
+	}
+}
+
+func (gb *grpcBackend) Capabilities(ctx context.Context) (*remoteexecution.CacheCapabilities, error) {
+	sc, err := gb.capabilities.GetCapabilities(ctx, &remoteexecution.GetCapabilitiesRequest{
+		InstanceName: gb.instanceName,
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return sc.CacheCapabilities, nil
+}
+
+func (gb *grpcBackend) Close() error {
+	return gb.client.Close()
+}
@@ -0,0 +1,305 @@
+package bzlremotecache
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+
+	remoteexecution "github.com/bazelbuild/remote-apis/build/bazel/remote/execution/v2"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+)
+
+// httpBackend is a remote cache accessed with the HTTP caching protocol
+// of Bazel, storing the entries at <base URL>/ac/<hash> and
+// <base URL>/cas/<hash>.
+type httpBackend struct {
+	client  *http.Client
+	baseURL string
+
+	// user contains the basic auth credentials
+	// given in the URL of the remote cache.
+	user     *url.Userinfo
+	rpcCreds perRPCCredentials
+}
+
+func newHTTPBackend(remote, instanceName string, o *options) (*httpBackend, error) {
+	if instanceName != "" {
+		return nil, errors.New("instance names aren't supported by HTTP remote caches")
+	}
+
+	u, err := url.Parse(remote)
+	if err != nil {
+		return nil, fmt.Errorf("invalid remote cache URL: %v", err)
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+
+	switch {
+	case o.tls != nil && u.Scheme == "http":
+		return nil, errors.New("TLS options given for a http:// remote cache, use https:// instead")
+	case o.tls != nil:
+		if transport.TLSClientConfig, err = newTLSConfig(o.tls); err != nil {
+			return nil, err
+		}
+	}
+
+	hb := httpBackend{
+		client: &http.Client{
+			Transport: transport,
+		},
+		user: u.User,
+		rpcCreds: perRPCCredentials{
+			headers: o.headers,
+		},
+	}
+
+	// The credentials aren't part of the base URL,
+	// to not leak them in the error messages.
+	u.User = nil
+	hb.baseURL = strings.TrimSuffix(u.String(), "/")
+
+	if o.credentialHelper != "" {
+		hb.rpcCreds.helper = &credentialHelper{
+			path: o.credentialHelper,
+			uri:  hb.baseURL,
+		}
+	}
+
+	return &hb, nil
+}
+
+// newRequest returns an authenticated request of an entry.
+func (hb *httpBackend) newRequest(
+	ctx context.Context, method, kind string, digest *Digest, body io.Reader,
+) (*http.Request, error) {
+	req, err := http.NewRequestWithContext(ctx, method, hb.baseURL+"/"+kind+"/"+digest.Hash, body)
+	if err != nil {
+		return nil, err
+	}
+
+	req.Header.Set("User-Agent", "bazel-remote-cache-client")
+
+	if hb.user != nil {
+		password, _ := hb.user.Password()
+		req.SetBasicAuth(hb.user.Username(), password)
+	}
+
+	headers, err := hb.rpcCreds.GetRequestMetadata(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	for name, value := range headers {
+		req.Header.Set(name, value)
+	}
+
+	return req, nil
+}
+
+// do sends a request of an entry, and returns its response
+// if its status code is one of the expected ones.
+func (hb *httpBackend) do(
+	ctx context.Context, method, kind string, digest *Digest, body io.Reader,
+	setHeaders func(http.Header), expectedCodes ...int,
+) (*http.Response, error) {
+	// A body with a zero content length would be sent chunked.
+	if body != nil && digest.Size == 0 {
+		body = http.NoBody
+	}
+
+	req, err := hb.newRequest(ctx, method, kind, digest, body)
+	if err != nil {
+		return nil, err
+	}
+
+	if setHeaders != nil {
+		setHeaders(req.Header)
+	}
+
+	if body != nil {
+		req.ContentLength = digest.Size
+	}
+
+	resp, err := hb.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, code := range expectedCodes {
+		if resp.StatusCode == code {
+			return resp, nil
+		}
+	}
+
+	_ = resp.Body.Close()
+
+	return nil, httpStatusError(resp, kind, digest)
+}
+
+// httpStatusError returns the gRPC status error matching the HTTP status
+// of a response, so that the errors are handled like the gRPC ones.
+func httpStatusError(resp *http.Response, kind string, digest *Digest) error {
+	var code codes.Code
+	switch resp.StatusCode {
+	case http.StatusNotFound:
+		code = codes.NotFound
+	case http.StatusUnauthorized:
+		code = codes.Unauthenticated
+	case http.StatusForbidden:
+		code = codes.PermissionDenied
+	case http.StatusRequestedRangeNotSatisfiable:
+		code = codes.OutOfRange
+	default:
+		code = codes.Unknown
+	}
+
+	return status.Errorf(code, "%s /%s/%s: %s", resp.Request.Method, kind, digest.Hash, resp.Status)
+}
+
+func (hb *httpBackend) GetActionResult(
+	ctx context.Context, digest *Digest, opts GetCacheResultOptions,
+) (*remoteexecution.ActionResult, error) {
+	data, err := hb.get(ctx, acKind, digest)
+	if err != nil {
+		return nil, err
+	}
+
+	var ar remoteexecution.ActionResult
+	if err := proto.Unmarshal(data, &ar); err != nil {
+		return nil, fmt.Errorf("can't decode the action result: %v", err)
+	}
+
+	// Inline the outputs like a gRPC remote cache would do.
+	if opts.InlineStdout && ar.StdoutDigest != nil && len(ar.StdoutRaw) == 0 {
+		if ar.StdoutRaw, err = hb.get(ctx, casKind, DigestFromProto(ar.StdoutDigest)); err != nil {
+			ar.StdoutRaw = nil
+		}
+	}
+
+	if opts.InlineStderr && ar.StderrDigest != nil && len(ar.StderrRaw) == 0 {
+		if ar.StderrRaw, err = hb.get(ctx, casKind, DigestFromProto(ar.StderrDigest)); err != nil {
+			ar.StderrRaw = nil
+		}
+	}
+
+	return &ar, nil
+}
+
+func (hb *httpBackend) UpdateActionResult(
+	ctx context.Context, digest *Digest, ar *remoteexecution.ActionResult,
+) (*remoteexecution.ActionResult, error) {
+	data, err := proto.Marshal(ar)
+	if err != nil {
+		return nil, err
+	}
+
+	// The content length is the size of the action result, not of the action.
+	if err := hb.put(ctx, acKind, &Digest{Hash: digest.Hash, Size: int64(len(data))}, bytes.NewReader(data)); err != nil {
+		return nil, err
+	}
+
+	return ar, nil
+}
+
+func (hb *httpBackend) FindMissingBlobs(ctx context.Context, digests []*Digest) ([]*Digest, error) {
+	var missing []*Digest
+	for _, digest := range digests {
+		resp, err := hb.do(ctx, http.MethodHead, casKind, digest, nil, nil, http.StatusOK)
+		if status.Code(err) == codes.NotFound {
+			missing = append(missing, digest)
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+
+		_ = resp.Body.Close()
+	}
+
+	return missing, nil
+}
+
+func (hb *httpBackend) BatchReadBlobs(ctx context.Context, results []BlobResult) {
+	for i := range results {
+		results[i].Data, results[i].Err = hb.get(ctx, casKind, results[i].Digest)
+	}
+}
+
+func (hb *httpBackend) BatchUpdateBlobs(ctx context.Context, results []BlobResult) {
+	for i, r := range results {
+		results[i].Err = hb.put(ctx, casKind, r.Digest, bytes.NewReader(r.Data))
+	}
+}
+
+func (hb *httpBackend) ReadBlob(ctx context.Context, digest *Digest, offset int64, w io.Writer) (int64, error) {
+	var setRange func(http.Header)
+	if offset > 0 {
+		setRange = func(h http.Header) {
+			h.Set("Range", fmt.Sprintf("bytes=%d-", offset))
+		}
+	}
+
+	resp, err := hb.do(ctx, http.MethodGet, casKind, digest, nil, setRange, http.StatusOK, http.StatusPartialContent)
+	if err != nil {
+		return 0, err
+	}
+
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+
+	// The whole blob is returned by the caches ignoring the range.
+	if offset > 0 && resp.StatusCode == http.StatusOK {
+		if _, err := io.CopyN(io.Discard, resp.Body, offset); err != nil {
+			return 0, err
+		}
+	}
+
+	return io.Copy(w, resp.Body)
+}
+
+func (hb *httpBackend) WriteBlob(ctx context.Context, digest *Digest, r io.Reader) error {
+	return hb.put(ctx, casKind, digest, r)
+}
+
+func (hb *httpBackend) Capabilities(ctx context.Context) (*remoteexecution.CacheCapabilities, error) {
+	return defaultCacheCapabilities(true), nil
+}
+
+func (hb *httpBackend) Close() error {
+	hb.client.CloseIdleConnections()
+	return nil
+}
+
+// get returns the content of an entry.
+func (hb *httpBackend) get(ctx context.Context, kind string, digest *Digest) ([]byte, error) {
+	resp, err := hb.do(ctx, http.MethodGet, kind, digest, nil, nil, http.StatusOK)
+	if err != nil {
+		return nil, err
+	}
+
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+
+	return io.ReadAll(resp.Body)
+}
+
+// put stores the content of an entry read from r.
+func (hb *httpBackend) put(ctx context.Context, kind string, digest *Digest, r io.Reader) error {
+	resp, err := hb.do(
+		ctx, http.MethodPut, kind, digest, r, nil,
+		http.StatusOK, http.StatusCreated, http.StatusNoContent,
+	)
+	if err != nil {
+		return err
+	}
+
+	return resp.Body.Close()
+}
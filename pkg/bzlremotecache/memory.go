@@ -0,0 +1,157 @@
+package bzlremotecache
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"sync"
+
+	remoteexecution "github.com/bazelbuild/remote-apis/build/bazel/remote/execution/v2"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+)
+
+// MemoryBackend is a cache stored in memory, e.g. to test the commands
+// without a remote cache.
+type MemoryBackend struct {
+	mu  sync.Mutex
+	ac  map[Digest]*remoteexecution.ActionResult
+	cas map[Digest][]byte
+}
+
+// NewMemoryBackend creates an empty in-memory cache.
+func NewMemoryBackend() *MemoryBackend {
+	return &MemoryBackend{
+		ac:  make(map[Digest]*remoteexecution.ActionResult),
+		cas: make(map[Digest][]byte),
+	}
+}
+
+// GetActionResult returns a stored action result, inlining its stdout and
+// stderr when requested.
+func (mb *MemoryBackend) GetActionResult(
+	ctx context.Context, digest *Digest, opts GetCacheResultOptions,
+) (*remoteexecution.ActionResult, error) {
+	mb.mu.Lock()
+	defer mb.mu.Unlock()
+
+	ar, ok := mb.ac[*digest]
+	if !ok {
+		return nil, status.Errorf(codes.NotFound, "action result %s not found", digest)
+	}
+
+	ar = proto.Clone(ar).(*remoteexecution.ActionResult)
+
+	if opts.InlineStdout && ar.StdoutDigest != nil && len(ar.StdoutRaw) == 0 {
+		ar.StdoutRaw = mb.cas[*DigestFromProto(ar.StdoutDigest)]
+	}
+
+	if opts.InlineStderr && ar.StderrDigest != nil && len(ar.StderrRaw) == 0 {
+		ar.StderrRaw = mb.cas[*DigestFromProto(ar.StderrDigest)]
+	}
+
+	return ar, nil
+}
+
+// UpdateActionResult stores an action result.
+func (mb *MemoryBackend) UpdateActionResult(
+	ctx context.Context, digest *Digest, ar *remoteexecution.ActionResult,
+) (*remoteexecution.ActionResult, error) {
+	mb.mu.Lock()
+	defer mb.mu.Unlock()
+
+	mb.ac[*digest] = proto.Clone(ar).(*remoteexecution.ActionResult)
+
+	return ar, nil
+}
+
+// FindMissingBlobs returns the given blobs which aren't stored.
+func (mb *MemoryBackend) FindMissingBlobs(ctx context.Context, digests []*Digest) ([]*Digest, error) {
+	mb.mu.Lock()
+	defer mb.mu.Unlock()
+
+	var missing []*Digest
+	for _, digest := range digests {
+		if _, ok := mb.cas[*digest]; !ok {
+			missing = append(missing, digest)
+		}
+	}
+
+	return missing, nil
+}
+
+// BatchReadBlobs reads the content of the given blobs.
+func (mb *MemoryBackend) BatchReadBlobs(ctx context.Context, results []BlobResult) {
+	mb.mu.Lock()
+	defer mb.mu.Unlock()
+
+	for i, r := range results {
+		data, ok := mb.cas[*r.Digest]
+		if !ok {
+			results[i].Err = status.Errorf(codes.NotFound, "blob %s not found", r.Digest)
+			continue
+		}
+
+		results[i].Data = data
+	}
+}
+
+// BatchUpdateBlobs stores the given blobs, checking their digests.
+func (mb *MemoryBackend) BatchUpdateBlobs(ctx context.Context, results []BlobResult) {
+	for i, r := range results {
+		results[i].Err = mb.WriteBlob(ctx, r.Digest, bytes.NewReader(r.Data))
+	}
+}
+
+// ReadBlob writes the content of a blob to w from the given offset.
+func (mb *MemoryBackend) ReadBlob(ctx context.Context, digest *Digest, offset int64, w io.Writer) (int64, error) {
+	mb.mu.Lock()
+	data, ok := mb.cas[*digest]
+	mb.mu.Unlock()
+
+	if !ok {
+		return 0, status.Errorf(codes.NotFound, "blob %s not found", digest)
+	}
+
+	if offset > int64(len(data)) {
+		return 0, status.Errorf(codes.OutOfRange, "offset %d exceeds the size of blob %s", offset, digest)
+	}
+
+	n, err := w.Write(data[offset:])
+	return int64(n), err
+}
+
+// WriteBlob stores a blob read from r, checking its digest.
+func (mb *MemoryBackend) WriteBlob(ctx context.Context, digest *Digest, r io.Reader) error {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return err
+	}
+
+	actual, err := ComputeDigest(bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+
+	if *actual != *digest {
+		return status.Errorf(codes.InvalidArgument, "blob %s doesn't match its content digest %s", digest, actual)
+	}
+
+	mb.mu.Lock()
+	defer mb.mu.Unlock()
+
+	mb.cas[*digest] = data
+
+	return nil
+}
+
+// Capabilities returns the capabilities of a cache accepting updates.
+func (mb *MemoryBackend) Capabilities(ctx context.Context) (*remoteexecution.CacheCapabilities, error) {
+	return defaultCacheCapabilities(true), nil
+}
+
+// Close does nothing, there is nothing to release.
+func (mb *MemoryBackend) Close() error {
+	return nil
+}
@@ -0,0 +1,78 @@
+package bzlremotecache
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"os"
+
+	"google.golang.org/grpc/credentials"
+)
+
+// TLSOptions contains the TLS configuration used to connect
+// to a Bazel remote cache.
+type TLSOptions struct {
+	// CACertFile is a PEM file containing the certificate authorities
+	// used to verify the server certificate. The system certificate
+	// pool is used when empty.
+	CACertFile string
+
+	// ClientCertFile and ClientKeyFile are the PEM files of the client
+	// certificate and its private key used for mutual TLS.
+	ClientCertFile string
+	ClientKeyFile  string
+
+	// ServerName overrides the server name used to verify
+	// the server certificate.
+	ServerName string
+}
+
+// IsZero reports whether no TLS option is set.
+func (o TLSOptions) IsZero() bool {
+	return o == TLSOptions{}
+}
+
+func newTLSCredentials(o *TLSOptions) (credentials.TransportCredentials, error) {
+	cfg, err := newTLSConfig(o)
+	if err != nil {
+		return nil, err
+	}
+
+	return credentials.NewTLS(cfg), nil
+}
+
+func newTLSConfig(o *TLSOptions) (*tls.Config, error) {
+	cfg := tls.Config{
+		MinVersion: tls.VersionTLS12,
+		ServerName: o.ServerName,
+	}
+
+	if o.CACertFile != "" {
+		caCert, err := os.ReadFile(o.CACertFile)
+		if err != nil {
+			return nil, fmt.Errorf("can't read the TLS certificate: %v", err)
+		}
+
+		cfg.RootCAs = x509.NewCertPool()
+		if !cfg.RootCAs.AppendCertsFromPEM(caCert) {
+			return nil, fmt.Errorf("no valid certificate found in %s", o.CACertFile)
+		}
+	}
+
+	switch {
+	case o.ClientCertFile != "" && o.ClientKeyFile != "":
+		cert, err := tls.LoadX509KeyPair(o.ClientCertFile, o.ClientKeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("can't load the TLS client certificate: %v", err)
+		}
+
+		cfg.Certificates = []tls.Certificate{cert}
+	case o.ClientCertFile != "":
+		return nil, errors.New("TLS client certificate given without its private key")
+	case o.ClientKeyFile != "":
+		return nil, errors.New("TLS client key given without its certificate")
+	}
+
+	return &cfg, nil
+}
@@ -0,0 +1,200 @@
+package bzlremotecache
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"path"
+
+	remoteexecution "github.com/bazelbuild/remote-apis/build/bazel/remote/execution/v2"
+	"google.golang.org/protobuf/proto"
+)
+
+// GetProto reads a blob and unmarshals it into the given proto message.
+func (brc *BazelRemoteCache) GetProto(ctx context.Context, digest *Digest, m proto.Message) error {
+	data, err := brc.GetBlob(ctx, digest)
+	if err != nil {
+		return err
+	}
+
+	if err := proto.Unmarshal(data, m); err != nil {
+		return fmt.Errorf("can't decode blob %s: %v", digest, err)
+	}
+
+	return nil
+}
+
+// GetTree returns the Tree proto of an output directory.
+func (brc *BazelRemoteCache) GetTree(ctx context.Context, digest *Digest) (*remoteexecution.Tree, error) {
+	var tree remoteexecution.Tree
+	if err := brc.GetProto(ctx, digest, &tree); err != nil {
+		return nil, err
+	}
+
+	return &tree, nil
+}
+
+// ComputeProtoDigest computes the digest of the deterministic
+// serialization of the given proto message.
+func ComputeProtoDigest(m proto.Message) (*Digest, error) {
+	data, err := proto.MarshalOptions{Deterministic: true}.Marshal(m)
+	if err != nil {
+		return nil, err
+	}
+
+	return ComputeDigest(bytes.NewReader(data))
+}
+
+// DirectoryGetter returns the Directory proto of the given digest.
+type DirectoryGetter func(ctx context.Context, digest *Digest) (*remoteexecution.Directory, error)
+
+// TreeDirectoryGetter returns a DirectoryGetter of the children
+// directories of the given tree.
+func TreeDirectoryGetter(tree *remoteexecution.Tree) (DirectoryGetter, error) {
+	children := make(map[Digest]*remoteexecution.Directory, len(tree.Children))
+	for _, child := range tree.Children {
+		digest, err := ComputeProtoDigest(child)
+		if err != nil {
+			return nil, err
+		}
+
+		children[*digest] = child
+	}
+
+	return func(_ context.Context, digest *Digest) (*remoteexecution.Directory, error) {
+		dir, ok := children[*digest]
+		if !ok {
+			return nil, fmt.Errorf("directory %s not found in the tree", digest)
+		}
+
+		return dir, nil
+	}, nil
+}
+
+// GetDirectories fetches the Directory protos of the given digests and of all
+// their subdirectories, and returns a DirectoryGetter of them, e.g. to walk an
+// input root. The directories are fetched level by level, with as few batch
+// requests as allowed by the maximum batch size of the cache, and a directory
+// shared by several parents is only fetched once.
+func (brc *BazelRemoteCache) GetDirectories(ctx context.Context, digests ...*Digest) (DirectoryGetter, error) {
+	dirs := make(map[Digest]*remoteexecution.Directory)
+
+	for level := digests; len(level) > 0; {
+		var (
+			batched []*Digest
+			large   []*Digest
+			next    []*Digest
+		)
+
+		queued := make(map[Digest]bool, len(level))
+		for _, digest := range level {
+			if _, ok := dirs[*digest]; ok || queued[*digest] {
+				continue
+			}
+
+			queued[*digest] = true
+			if brc.IsBatchable(ctx, digest) {
+				batched = append(batched, digest)
+			} else {
+				large = append(large, digest)
+			}
+		}
+
+		addDirectory := func(digest *Digest, data []byte) error {
+			var dir remoteexecution.Directory
+			if err := proto.Unmarshal(data, &dir); err != nil {
+				return fmt.Errorf("can't decode blob %s: %v", digest, err)
+			}
+
+			dirs[*digest] = &dir
+			for _, subdir := range dir.Directories {
+				next = append(next, DigestFromProto(subdir.Digest))
+			}
+
+			return nil
+		}
+
+		var err error
+		brc.GetBlobsFunc(ctx, batched, func(_ int, r BlobResult) {
+			switch {
+			case err != nil:
+			case r.Err != nil:
+				err = r.Err
+			default:
+				err = addDirectory(r.Digest, r.Data)
+			}
+		})
+
+		if err != nil {
+			return nil, err
+		}
+
+		for _, digest := range large {
+			data, err := brc.GetBlob(ctx, digest)
+			if err != nil {
+				return nil, err
+			}
+
+			if err := addDirectory(digest, data); err != nil {
+				return nil, err
+			}
+		}
+
+		level = next
+	}
+
+	return func(_ context.Context, digest *Digest) (*remoteexecution.Directory, error) {
+		dir, ok := dirs[*digest]
+		if !ok {
+			return nil, fmt.Errorf("directory %s not found", digest)
+		}
+
+		return dir, nil
+	}, nil
+}
+
+// WalkFunc is called by WalkDirectory for each node of a directory with its
+// path relative to the walked directory. The node is a *FileNode,
+// a *DirectoryNode or a *SymlinkNode of the remote execution API.
+type WalkFunc func(nodePath string, node proto.Message) error
+
+// WalkDirectory walks recursively the given directory, calling fn for each
+// of its nodes. A directory node is given to fn before its content.
+func WalkDirectory(ctx context.Context, dir *remoteexecution.Directory, getDir DirectoryGetter, fn WalkFunc) error {
+	return walkDirectory(ctx, "", dir, getDir, fn)
+}
+
+func walkDirectory(
+	ctx context.Context, dirPath string, dir *remoteexecution.Directory,
+	getDir DirectoryGetter, fn WalkFunc,
+) error {
+	for _, file := range dir.Files {
+		if err := fn(path.Join(dirPath, file.Name), file); err != nil {
+			return err
+		}
+	}
+
+	for _, symlink := range dir.Symlinks {
+		if err := fn(path.Join(dirPath, symlink.Name), symlink); err != nil {
+			return err
+		}
+	}
+
+	for _, subdir := range dir.Directories {
+		subdirPath := path.Join(dirPath, subdir.Name)
+		if err := fn(subdirPath, subdir); err != nil {
+			return err
+		}
+
+		child, err := getDir(ctx, DigestFromProto(subdir.Digest))
+		if err != nil {
+			return err
+		}
+
+		if err := walkDirectory(ctx, subdirPath, child, getDir, fn); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,68 @@
+package bzlremotecache
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"google.golang.org/protobuf/proto"
+)
+
+func TestGetDirectories(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+
+	for _, filePath := range []string{"a/x/file", "b/x/file", "b/y/z/file", "file"} {
+		if err := os.MkdirAll(filepath.Join(dir, filepath.Dir(filePath)), 0755); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := os.WriteFile(filepath.Join(dir, filePath), []byte(filePath), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	ld, err := ReadLocalDirectory(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	brc := NewWithBackend(NewMemoryBackend())
+	if _, err := brc.UploadBlobs(ctx, ld.Blobs, 1); err != nil {
+		t.Fatal(err)
+	}
+
+	walk := func(getDir DirectoryGetter) []string {
+		root, err := getDir(ctx, ld.RootDigest)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var paths []string
+		err = WalkDirectory(ctx, root, getDir, func(nodePath string, _ proto.Message) error {
+			paths = append(paths, nodePath)
+			return nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		return paths
+	}
+
+	getDir, err := brc.GetDirectories(ctx, ld.RootDigest)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := walk(brc.GetDirectory)
+	if paths := walk(getDir); !reflect.DeepEqual(paths, expected) {
+		t.Errorf("expected %v, got %v", expected, paths)
+	}
+
+	if _, err := brc.GetDirectories(ctx, ld.RootDigest, &Digest{Hash: ld.RootDigest.Hash, Size: 1}); err == nil {
+		t.Error("expected an error for a missing directory")
+	}
+}
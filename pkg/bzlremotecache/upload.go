@@ -0,0 +1,418 @@
+package bzlremotecache
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sync"
+
+	remoteexecution "github.com/bazelbuild/remote-apis/build/bazel/remote/execution/v2"
+	"google.golang.org/protobuf/proto"
+)
+
+// Blob is a blob to upload, whose content is in memory or in a local file.
+type Blob struct {
+	Digest *Digest
+	Data   []byte
+	Path   string
+}
+
+// NewFileBlob returns the blob of a local file.
+func NewFileBlob(filePath string) (*Blob, error) {
+	f, err := os.Open(filePath)
+	if err != nil {
+		return nil, err
+	}
+
+	defer func() {
+		_ = f.Close()
+	}()
+
+	digest, err := ComputeDigest(bufio.NewReader(f))
+	if err != nil {
+		return nil, fmt.Errorf("can't read %s: %v", filePath, err)
+	}
+
+	return &Blob{
+		Digest: digest,
+		Path:   filePath,
+	}, nil
+}
+
+// NewProtoBlob returns the blob of the deterministic serialization
+// of a proto message.
+func NewProtoBlob(m proto.Message) (*Blob, error) {
+	data, err := proto.MarshalOptions{Deterministic: true}.Marshal(m)
+	if err != nil {
+		return nil, err
+	}
+
+	digest, err := ComputeDigest(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+
+	return &Blob{
+		Digest: digest,
+		Data:   data,
+	}, nil
+}
+
+// open returns a reader of the content of the blob. The content of a local
+// file is checked against the digest of the blob while it is read, as the
+// file may have changed since its digest was computed.
+func (b *Blob) open() (io.ReadCloser, error) {
+	if b.Path == "" {
+		return io.NopCloser(bytes.NewReader(b.Data)), nil
+	}
+
+	f, err := os.Open(b.Path)
+	if err != nil {
+		return nil, err
+	}
+
+	return &verifyingReader{
+		ReadCloser: f,
+		blob:       b,
+		hash:       sha256.New(),
+	}, nil
+}
+
+// readAll returns the content of the blob, checking the content
+// of a local file against the digest of the blob.
+func (b *Blob) readAll() ([]byte, error) {
+	if b.Path == "" {
+		return b.Data, nil
+	}
+
+	data, err := os.ReadFile(b.Path)
+	if err != nil {
+		return nil, err
+	}
+
+	actual, err := ComputeDigest(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+
+	if *actual != *b.Digest {
+		return nil, b.changedError()
+	}
+
+	return data, nil
+}
+
+// changedError returns the error of a local file whose content
+// doesn't match the digest of the blob anymore.
+func (b *Blob) changedError() error {
+	return fmt.Errorf("%s has changed since its digest %s was computed", b.Path, b.Digest)
+}
+
+// verifyingReader reads a local file, failing instead of reaching its end
+// if its content doesn't match the digest of the blob, so that the upload
+// is aborted.
+type verifyingReader struct {
+	io.ReadCloser
+	blob *Blob
+	hash hash.Hash
+	size int64
+}
+
+func (vr *verifyingReader) Read(p []byte) (int, error) {
+	n, err := vr.ReadCloser.Read(p)
+	_, _ = vr.hash.Write(p[:n])
+	vr.size += int64(n)
+
+	if vr.size > vr.blob.Digest.Size {
+		return n, vr.blob.changedError()
+	}
+
+	if errors.Is(err, io.EOF) &&
+		(vr.size != vr.blob.Digest.Size || hex.EncodeToString(vr.hash.Sum(nil)) != vr.blob.Digest.Hash) {
+		return n, vr.blob.changedError()
+	}
+
+	return n, err
+}
+
+// LocalDirectory contains the blobs of a local directory: its files and its
+// Directory protos, as well as the Tree proto of the whole directory.
+type LocalDirectory struct {
+	RootDigest *Digest
+	Tree       *remoteexecution.Tree
+	TreeDigest *Digest
+	Blobs      []*Blob
+
+	children map[Digest]bool
+}
+
+// ReadLocalDirectory reads the blobs of a local directory. The symbolic
+// links of the directory are kept as is.
+func ReadLocalDirectory(dirPath string) (*LocalDirectory, error) {
+	ld := LocalDirectory{
+		Tree:     &remoteexecution.Tree{},
+		children: make(map[Digest]bool),
+	}
+
+	root, rootDigest, err := ld.addDirectory(dirPath)
+	if err != nil {
+		return nil, err
+	}
+
+	ld.RootDigest = rootDigest
+	ld.Tree.Root = root
+
+	treeBlob, err := NewProtoBlob(ld.Tree)
+	if err != nil {
+		return nil, err
+	}
+
+	ld.TreeDigest = treeBlob.Digest
+	ld.Blobs = append(ld.Blobs, treeBlob)
+
+	return &ld, nil
+}
+
+// addDirectory adds the blobs of a directory and its subdirectories,
+// and returns its Directory proto and its digest.
+func (ld *LocalDirectory) addDirectory(dirPath string) (*remoteexecution.Directory, *Digest, error) {
+	// The entries are sorted by name, as required for the Directory protos.
+	entries, err := os.ReadDir(dirPath)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var dir remoteexecution.Directory
+	for _, entry := range entries {
+		entryPath := filepath.Join(dirPath, entry.Name())
+
+		switch {
+		case entry.Type()&fs.ModeSymlink != 0:
+			target, err := os.Readlink(entryPath)
+			if err != nil {
+				return nil, nil, err
+			}
+
+			dir.Symlinks = append(dir.Symlinks, &remoteexecution.SymlinkNode{
+				Name:   entry.Name(),
+				Target: target,
+			})
+		case entry.IsDir():
+			child, childDigest, err := ld.addDirectory(entryPath)
+			if err != nil {
+				return nil, nil, err
+			}
+
+			if !ld.children[*childDigest] {
+				ld.children[*childDigest] = true
+				ld.Tree.Children = append(ld.Tree.Children, child)
+			}
+
+			dir.Directories = append(dir.Directories, &remoteexecution.DirectoryNode{
+				Name:   entry.Name(),
+				Digest: childDigest.ToProto(),
+			})
+		case entry.Type().IsRegular():
+			info, err := entry.Info()
+			if err != nil {
+				return nil, nil, err
+			}
+
+			blob, err := NewFileBlob(entryPath)
+			if err != nil {
+				return nil, nil, err
+			}
+
+			ld.Blobs = append(ld.Blobs, blob)
+
+			dir.Files = append(dir.Files, &remoteexecution.FileNode{
+				Name:         entry.Name(),
+				Digest:       blob.Digest.ToProto(),
+				IsExecutable: info.Mode()&0111 != 0,
+			})
+		default:
+			return nil, nil, fmt.Errorf("unsupported file type of %s", entryPath)
+		}
+	}
+
+	blob, err := NewProtoBlob(&dir)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	ld.Blobs = append(ld.Blobs, blob)
+
+	return &dir, blob.Digest, nil
+}
+
+// FindMissingBlobs returns the given blobs which aren't stored in the cache.
+// The digests are split into several requests so that none of them exceeds
+// the maximum batch size of the cache.
+func (brc *BazelRemoteCache) FindMissingBlobs(ctx context.Context, digests []*Digest) ([]*Digest, error) {
+	maxDigests := int((brc.maxBatchSize(ctx) - batchRequestOverhead) / batchBlobOverhead)
+
+	var missing []*Digest
+	for start := 0; start < len(digests); start += maxDigests {
+		end := start + maxDigests
+		if end > len(digests) {
+			end = len(digests)
+		}
+
+		batchMissing, err := brc.backend.FindMissingBlobs(ctx, digests[start:end])
+		if err != nil {
+			return nil, err
+		}
+
+		missing = append(missing, batchMissing...)
+	}
+
+	return missing, nil
+}
+
+// UploadBlobs uploads the given blobs which aren't stored in the cache,
+// and returns the uploaded ones.
+//
+// Small blobs are uploaded with as few batch requests as allowed by the
+// maximum batch size of the cache, while large ones are concurrently
+// streamed, with the ByteStream API for a gRPC remote cache.
+func (brc *BazelRemoteCache) UploadBlobs(ctx context.Context, blobs []*Blob, jobs int) ([]*Blob, error) {
+	unique := make(map[Digest]*Blob, len(blobs))
+	digests := make([]*Digest, 0, len(blobs))
+	for _, blob := range blobs {
+		if _, ok := unique[*blob.Digest]; !ok {
+			unique[*blob.Digest] = blob
+			digests = append(digests, blob.Digest)
+		}
+	}
+
+	missing, err := brc.FindMissingBlobs(ctx, digests)
+	if err != nil {
+		return nil, fmt.Errorf("can't find the missing blobs: %v", err)
+	}
+
+	uploaded := make([]*Blob, len(missing))
+
+	var (
+		batched []*Blob
+		large   []*Blob
+	)
+
+	for i, digest := range missing {
+		blob, ok := unique[*digest]
+		if !ok {
+			return nil, fmt.Errorf("unknown missing blob %s", digest)
+		}
+
+		uploaded[i] = blob
+		if brc.IsBatchable(ctx, digest) {
+			batched = append(batched, blob)
+		} else {
+			large = append(large, blob)
+		}
+	}
+
+	if err := brc.batchUploadBlobs(ctx, batched); err != nil {
+		return nil, err
+	}
+
+	if err := brc.writeBlobs(ctx, large, jobs); err != nil {
+		return nil, err
+	}
+
+	return uploaded, nil
+}
+
+// batchUploadBlobs uploads the given blobs with batch requests.
+func (brc *BazelRemoteCache) batchUploadBlobs(ctx context.Context, blobs []*Blob) error {
+	maxSize := brc.maxBatchSize(ctx) - batchRequestOverhead
+
+	for start := 0; start < len(blobs); {
+		var (
+			results []BlobResult
+			size    int64
+		)
+
+		end := start
+		for end < len(blobs) && (end == start || size+blobs[end].Digest.Size+batchBlobOverhead <= maxSize) {
+			data, err := blobs[end].readAll()
+			if err != nil {
+				return err
+			}
+
+			results = append(results, BlobResult{
+				Digest: blobs[end].Digest,
+				Data:   data,
+			})
+			size += blobs[end].Digest.Size + batchBlobOverhead
+			end++
+		}
+
+		brc.backend.BatchUpdateBlobs(ctx, results)
+
+		for _, r := range results {
+			if r.Err != nil {
+				return fmt.Errorf("can't upload blob %s: %v", r.Digest, r.Err)
+			}
+		}
+
+		start = end
+	}
+
+	return nil
+}
+
+// writeBlobs concurrently streams the given blobs.
+func (brc *BazelRemoteCache) writeBlobs(ctx context.Context, blobs []*Blob, jobs int) error {
+	errs := make([]error, len(blobs))
+	indexes := make(chan int)
+
+	var wg sync.WaitGroup
+	for w := 0; w < jobs; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			for i := range indexes {
+				errs[i] = brc.writeBlob(ctx, blobs[i])
+			}
+		}()
+	}
+
+	for i := range blobs {
+		indexes <- i
+	}
+	close(indexes)
+
+	wg.Wait()
+
+	for i, err := range errs {
+		if err != nil {
+			return fmt.Errorf("can't upload blob %s: %v", blobs[i].Digest, err)
+		}
+	}
+
+	return nil
+}
+
+// writeBlob streams a blob.
+func (brc *BazelRemoteCache) writeBlob(ctx context.Context, blob *Blob) error {
+	r, err := blob.open()
+	if err != nil {
+		return err
+	}
+
+	defer func() {
+		_ = r.Close()
+	}()
+
+	return brc.backend.WriteBlob(ctx, blob.Digest, bufio.NewReader(r))
+}
@@ -0,0 +1,151 @@
+package bzlremotecache
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	remoteexecution "github.com/bazelbuild/remote-apis/build/bazel/remote/execution/v2"
+	"google.golang.org/protobuf/proto"
+)
+
+func TestUploadBlobs(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+
+	backend := NewMemoryBackend()
+	brc := NewWithBackend(backend)
+
+	var blobs []*Blob
+	for name, size := range map[string]int{"small": 1024, "large": 5 << 20} {
+		filePath := filepath.Join(dir, name)
+		if err := os.WriteFile(filePath, bytes.Repeat([]byte(name), size), 0644); err != nil {
+			t.Fatal(err)
+		}
+
+		blob, err := NewFileBlob(filePath)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		blobs = append(blobs, blob)
+	}
+
+	uploaded, err := brc.UploadBlobs(ctx, blobs, 2)
+	if err != nil {
+		t.Fatalf("upload failed: %v", err)
+	}
+
+	if len(uploaded) != 2 {
+		t.Errorf("expected 2 uploaded blobs, got %d", len(uploaded))
+	}
+
+	if uploaded, err = brc.UploadBlobs(ctx, blobs, 2); err != nil || len(uploaded) != 0 {
+		t.Errorf("expected no uploaded blobs, got %d (%v)", len(uploaded), err)
+	}
+}
+
+func TestUploadBlobsChangedFile(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+
+	for name, size := range map[string]int{"small": 1024, "large": 5 << 20} {
+		t.Run(name, func(t *testing.T) {
+			brc := NewWithBackend(NewMemoryBackend())
+
+			filePath := filepath.Join(dir, name)
+			if err := os.WriteFile(filePath, bytes.Repeat([]byte("a"), size), 0644); err != nil {
+				t.Fatal(err)
+			}
+
+			blob, err := NewFileBlob(filePath)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if err := os.WriteFile(filePath, bytes.Repeat([]byte("b"), size), 0644); err != nil {
+				t.Fatal(err)
+			}
+
+			_, err = brc.UploadBlobs(ctx, []*Blob{blob}, 1)
+			if err == nil || !strings.Contains(err.Error(), "has changed") {
+				t.Errorf("expected a changed file error, got %v", err)
+			}
+
+			missing, err := brc.FindMissingBlobs(ctx, []*Digest{blob.Digest})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if len(missing) != 1 {
+				t.Error("expected the blob to not be stored")
+			}
+		})
+	}
+}
+
+// limitedBackend is a backend rejecting the FindMissingBlobs requests
+// exceeding its maximum batch size.
+type limitedBackend struct {
+	Backend
+
+	maxBatchSize int64
+	requests     int
+}
+
+func (lb *limitedBackend) Capabilities(ctx context.Context) (*remoteexecution.CacheCapabilities, error) {
+	return &remoteexecution.CacheCapabilities{MaxBatchTotalSizeBytes: lb.maxBatchSize}, nil
+}
+
+func (lb *limitedBackend) FindMissingBlobs(ctx context.Context, digests []*Digest) ([]*Digest, error) {
+	lb.requests++
+
+	req := remoteexecution.FindMissingBlobsRequest{BlobDigests: make([]*remoteexecution.Digest, len(digests))}
+	for i, digest := range digests {
+		req.BlobDigests[i] = digest.ToProto()
+	}
+
+	if size := proto.Size(&req); int64(size) > lb.maxBatchSize {
+		return nil, fmt.Errorf("request of %d bytes exceeding the maximum batch size", size)
+	}
+
+	return lb.Backend.FindMissingBlobs(ctx, digests)
+}
+
+func TestFindMissingBlobsSplit(t *testing.T) {
+	ctx := context.Background()
+
+	memory := NewMemoryBackend()
+	backend := limitedBackend{Backend: memory, maxBatchSize: 64 << 10}
+	brc := NewWithBackend(&backend)
+
+	stored := &Digest{
+		Hash: "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855",
+		Size: 0,
+	}
+	if err := memory.WriteBlob(ctx, stored, bytes.NewReader(nil)); err != nil {
+		t.Fatal(err)
+	}
+
+	digests := []*Digest{stored}
+	for i := 0; i < 10000; i++ {
+		digests = append(digests, &Digest{Hash: fmt.Sprintf("%064x", i+1), Size: int64(i)})
+	}
+
+	missing, err := brc.FindMissingBlobs(ctx, digests)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(missing) != len(digests)-1 {
+		t.Errorf("expected %d missing blobs, got %d", len(digests)-1, len(missing))
+	}
+
+	if backend.requests < 2 {
+		t.Errorf("expected several requests, got %d", backend.requests)
+	}
+}
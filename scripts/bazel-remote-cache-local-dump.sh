@@ -8,4 +8,4 @@ exec find "$bazel_cachedir/ac.v2" -type f -printf "%T@ %f\n" |
     sort -n |
     awk '{ print $2 }' |
     sed -r 's/-.*//' |
-    xargs -r bazel-remote-cache-client "$@" ac get
+    xargs -r bazel-remote-cache-client ac get --disk-cache "$bazel_cachedir" --allow-hash-only "$@"